@@ -1,6 +1,6 @@
 module github.com/masahiro331/go-xfs-filesystem
 
-go 1.18
+go 1.25
 
 require (
 	go.uber.org/zap v1.23.0
@@ -0,0 +1,142 @@
+package xfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/fs"
+	"unsafe"
+
+	"golang.org/x/xerrors"
+)
+
+// https://github.com/torvalds/linux/blob/5bfc75d92efd494db37f5c4c173d3639d4772966/fs/xfs/libxfs/xfs_format.h
+
+// ACLEntry is the on-disk xfs_acl_entry, xfs_acl is the count(be32) followed by the entries.
+type ACLEntry struct {
+	Tag  uint32
+	ID   uint32
+	Perm uint16
+	Pad  uint16
+}
+
+// ACL is a POSIX ACL, entries are sorted by the tag and the id same as on disk.
+type ACL []ACLEntry
+
+// ACL returns the access ACL of the named file.
+// The minimal ACL equivalent to the permission bits is returned if the file has no ACL.
+func (xfs *FileSystem) ACL(name string) (ACL, error) {
+	const op = "acl"
+
+	inode, err := xfs.resolve(name, true)
+	if err != nil {
+		return nil, xfs.wrapError(op, name, xerrors.Errorf("failed to resolve path: %w", err))
+	}
+	acl, err := xfs.readACL(inode, SGI_ACL_FILE)
+	if xerrors.Is(err, ErrNoXattr) {
+		mode := inode.inodeCore.Mode
+		return ACL{
+			{Tag: ACL_USER_OBJ, ID: ACL_UNDEFINED_ID, Perm: mode >> 6 & 0o7},
+			{Tag: ACL_GROUP_OBJ, ID: ACL_UNDEFINED_ID, Perm: mode >> 3 & 0o7},
+			{Tag: ACL_OTHER, ID: ACL_UNDEFINED_ID, Perm: mode & 0o7},
+		}, nil
+	} else if err != nil {
+		return nil, xfs.wrapError(op, name, err)
+	}
+	return acl, nil
+}
+
+// DefaultACL returns the default ACL of the named directory, it is nil if the directory has no default ACL.
+func (xfs *FileSystem) DefaultACL(name string) (ACL, error) {
+	const op = "acl"
+
+	inode, err := xfs.resolve(name, true)
+	if err != nil {
+		return nil, xfs.wrapError(op, name, xerrors.Errorf("failed to resolve path: %w", err))
+	}
+	acl, err := xfs.readACL(inode, SGI_ACL_DEFAULT)
+	if xerrors.Is(err, ErrNoXattr) {
+		return nil, nil
+	} else if err != nil {
+		return nil, xfs.wrapError(op, name, err)
+	}
+	return acl, nil
+}
+
+func (xfs *FileSystem) readACL(inode *Inode, attr string) (ACL, error) {
+	value, err := xfs.getXattr(inode, XattrTrustedPrefix+attr)
+	if err != nil {
+		return nil, err
+	}
+	acl, err := parseACL(value)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse %s: %w", attr, err)
+	}
+	return acl, nil
+}
+
+// parseACL decodes xfs_acl and validates the entries same as xfs_acl_from_disk.
+// https://github.com/torvalds/linux/blob/5bfc75d92efd494db37f5c4c173d3639d4772966/fs/xfs/xfs_acl.c
+func parseACL(buf []byte) (ACL, error) {
+	if len(buf) < 4 {
+		return nil, xerrors.Errorf("invalid acl size: %d", len(buf))
+	}
+	count := binary.BigEndian.Uint32(buf)
+	if uint64(len(buf)) != 4+uint64(count)*uint64(unsafe.Sizeof(ACLEntry{})) {
+		return nil, xerrors.Errorf("invalid acl count: %d, size: %d", count, len(buf))
+	}
+	acl := make(ACL, count)
+	if err := binary.Read(bytes.NewReader(buf[4:]), binary.BigEndian, acl); err != nil {
+		return nil, xerrors.Errorf("failed to read acl entries: %w", err)
+	}
+	for _, e := range acl {
+		switch e.Tag {
+		case ACL_USER_OBJ, ACL_GROUP_OBJ, ACL_MASK, ACL_OTHER, ACL_USER, ACL_GROUP:
+		default:
+			return nil, xerrors.Errorf("unknown acl tag: %x", e.Tag)
+		}
+	}
+	return acl, nil
+}
+
+// Mask returns the permissions of the ACL_MASK entry, ok is false if the ACL has no mask.
+func (a ACL) Mask() (perm uint16, ok bool) {
+	for _, e := range a {
+		if e.Tag == ACL_MASK {
+			return e.Perm, true
+		}
+	}
+	return 0, false
+}
+
+// EffectivePerm returns the permissions granted by the entry.
+// The mask limits named users, the owning group and named groups, see acl(5).
+func (a ACL) EffectivePerm(e ACLEntry) uint16 {
+	switch e.Tag {
+	case ACL_USER, ACL_GROUP_OBJ, ACL_GROUP:
+		if mask, ok := a.Mask(); ok {
+			return e.Perm & mask
+		}
+	}
+	return e.Perm
+}
+
+// Mode returns mode with the permission bits replaced by the ACL, mode is typically FileInfo.Mode().
+// The group class bits are the mask if the ACL has one, the owning group otherwise.
+func (a ACL) Mode(mode fs.FileMode) fs.FileMode {
+	var user, group, other uint16
+	for _, e := range a {
+		switch e.Tag {
+		case ACL_USER_OBJ:
+			user = e.Perm
+		case ACL_GROUP_OBJ:
+			group = e.Perm
+		case ACL_OTHER:
+			other = e.Perm
+		}
+	}
+	if mask, ok := a.Mask(); ok {
+		group = mask
+	}
+	perm := fs.FileMode(user&0o7)<<6 | fs.FileMode(group&0o7)<<3 | fs.FileMode(other&0o7)
+	return mode&^fs.ModePerm | perm
+}
@@ -0,0 +1,81 @@
+package xfs
+
+import (
+	"encoding/binary"
+	"io/fs"
+	"testing"
+)
+
+func TestParseACL(t *testing.T) {
+	encode := func(entries ...ACLEntry) []byte {
+		buf := binary.BigEndian.AppendUint32(nil, uint32(len(entries)))
+		for _, e := range entries {
+			buf = binary.BigEndian.AppendUint32(buf, e.Tag)
+			buf = binary.BigEndian.AppendUint32(buf, e.ID)
+			buf = binary.BigEndian.AppendUint16(buf, e.Perm)
+			buf = binary.BigEndian.AppendUint16(buf, 0)
+		}
+		return buf
+	}
+	acl := []ACLEntry{
+		{Tag: ACL_USER_OBJ, ID: ACL_UNDEFINED_ID, Perm: ACL_READ | ACL_WRITE},
+		{Tag: ACL_USER, ID: 1000, Perm: ACL_READ | ACL_WRITE | ACL_EXECUTE},
+		{Tag: ACL_GROUP_OBJ, ID: ACL_UNDEFINED_ID, Perm: ACL_READ | ACL_EXECUTE},
+		{Tag: ACL_MASK, ID: ACL_UNDEFINED_ID, Perm: ACL_READ},
+		{Tag: ACL_OTHER, ID: ACL_UNDEFINED_ID, Perm: 0},
+	}
+
+	testCases := []struct {
+		name              string
+		buf               []byte
+		expectedEffective []uint16
+		expectedMode      fs.FileMode
+		expectedErr       bool
+	}{
+		{
+			name:              "named user with mask",
+			buf:               encode(acl...),
+			expectedEffective: []uint16{ACL_READ | ACL_WRITE, ACL_READ, ACL_READ, ACL_READ, 0},
+			expectedMode:      fs.ModeDir | 0o640,
+		},
+		{
+			name:              "minimal",
+			buf:               encode(acl[0], acl[2], acl[4]),
+			expectedEffective: []uint16{ACL_READ | ACL_WRITE, ACL_READ | ACL_EXECUTE, 0},
+			expectedMode:      fs.ModeDir | 0o650,
+		},
+		{
+			name:        "truncated",
+			buf:         encode(acl...)[:20],
+			expectedErr: true,
+		},
+		{
+			name:        "unknown tag",
+			buf:         encode(ACLEntry{Tag: 0x40}),
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			acl, err := parseACL(tt.buf)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("name: %s, expected error %v, actual %v", tt.name, tt.expectedErr, err)
+			}
+			if tt.expectedErr {
+				return
+			}
+			if len(acl) != len(tt.expectedEffective) {
+				t.Fatalf("name: %s, expected %d entries, actual %d", tt.name, len(tt.expectedEffective), len(acl))
+			}
+			for i, e := range acl {
+				if perm := acl.EffectivePerm(e); perm != tt.expectedEffective[i] {
+					t.Errorf("name: %s, entry %d, expected %o, actual %o", tt.name, i, tt.expectedEffective[i], perm)
+				}
+			}
+			if mode := acl.Mode(fs.ModeDir | 0o777); mode != tt.expectedMode {
+				t.Errorf("name: %s, expected %v, actual %v", tt.name, tt.expectedMode, mode)
+			}
+		})
+	}
+}
@@ -22,13 +22,19 @@ type AG struct {
 	Fib3 FIB3
 }
 
+// AGFL is the AG free list, Bno fills the rest of the sector so its length depends on the sector size.
 type AGFL struct {
+	AGFLHdr
+	Bno []uint32
+}
+
+// AGFLHdr is the header of the v5 AGFL, v4 AGFL has no header.
+type AGFLHdr struct {
 	Magicnum uint32
 	Seqno    uint32
 	UUID     [16]byte
 	Lsn      uint64
 	CRC      uint32
-	Bno      [118]uint32
 }
 
 type AGF struct {
@@ -123,27 +129,31 @@ func parseSuperBlock(r io.Reader) (SuperBlock, error) {
 	if sb.Magicnum != XFS_SB_MAGIC {
 		return SuperBlock{}, xerrors.Errorf("failed to parse superblock magic byte error: %08x", sb.Magicnum)
 	}
+	if sb.Blocklog < XFS_MIN_BLOCKSIZE_LOG || sb.Blocklog > XFS_MAX_BLOCKSIZE_LOG || sb.BlockSize != 1<<sb.Blocklog {
+		return SuperBlock{}, xerrors.Errorf("invalid block size: %d (log %d)", sb.BlockSize, sb.Blocklog)
+	}
+	if sb.Inodelog < XFS_DINODE_MIN_LOG || sb.Inodelog > XFS_DINODE_MAX_LOG || sb.Inodesize != 1<<sb.Inodelog ||
+		uint32(sb.Inodesize) > sb.BlockSize || sb.Inopblock != uint16(sb.BlockSize/uint32(sb.Inodesize)) {
+		return SuperBlock{}, xerrors.Errorf("invalid inode size: %d (log %d, %d inodes per block)", sb.Inodesize, sb.Inodelog, sb.Inopblock)
+	}
+	if sb.Sectlog < XFS_MIN_SECTORSIZE_LOG || sb.Sectlog > XFS_MAX_SECTORSIZE_LOG || sb.Sectsize != 1<<sb.Sectlog ||
+		uint32(sb.Sectsize) > sb.BlockSize {
+		return SuperBlock{}, xerrors.Errorf("invalid sector size: %d (log %d)", sb.Sectsize, sb.Sectlog)
+	}
 
 	if sb.Sectsize != utils.SectorSize {
 		completeSector := int(sb.Sectsize - utils.SectorSize)
 		buf := make([]byte, completeSector)
-		i, err := r.Read(buf)
+		i, err := io.ReadFull(r, buf)
 		if err != nil {
-			return SuperBlock{}, xerrors.Errorf("failed to read: %w", err)
-		}
-		if i != completeSector {
-			return SuperBlock{}, xerrors.Errorf("sector size error, read %d byte", i)
+			return SuperBlock{}, xerrors.Errorf("sector size error, read %d byte: %w", i, err)
 		}
 	}
 	return sb, nil
 }
 
-func parseAGF(sectorReader utils.SectorReader, r io.Reader) (AGF, error) {
+func parseAGF(buf []byte) (AGF, error) {
 	var agf AGF
-	buf, err := sectorReader.ReadSector(r)
-	if err != nil {
-		return AGF{}, xerrors.Errorf("failed to create agf reader: %w", err)
-	}
 	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &agf); err != nil {
 		return AGF{}, xerrors.Errorf("failed to read agf: %w", err)
 	}
@@ -153,12 +163,8 @@ func parseAGF(sectorReader utils.SectorReader, r io.Reader) (AGF, error) {
 	return agf, nil
 }
 
-func parseAGI(sectorReader utils.SectorReader, r io.Reader) (AGI, error) {
+func parseAGI(buf []byte) (AGI, error) {
 	var agi AGI
-	buf, err := sectorReader.ReadSector(r)
-	if err != nil {
-		return AGI{}, xerrors.Errorf("failed to create agi reader: %w", err)
-	}
 	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &agi); err != nil {
 		return AGI{}, xerrors.Errorf("failed to read agi: %w", err)
 	}
@@ -168,53 +174,80 @@ func parseAGI(sectorReader utils.SectorReader, r io.Reader) (AGI, error) {
 	return agi, nil
 }
 
-func parseAGFL(sectorReader utils.SectorReader, r io.Reader) (AGFL, error) {
+func parseAGFL(sb SuperBlock, buf []byte) (AGFL, error) {
 	var agfl AGFL
-	buf, err := sectorReader.ReadSector(r)
-	if err != nil {
-		return AGFL{}, xerrors.Errorf("failed to create agfl reader: %w", err)
+	r := bytes.NewReader(buf)
+	if sb.HasCRC() {
+		if err := binary.Read(r, binary.BigEndian, &agfl.AGFLHdr); err != nil {
+			return AGFL{}, xerrors.Errorf("failed to read agfl header: %w", err)
+		}
+		if agfl.Magicnum != XFS_AGFL_MAGIC {
+			return AGFL{}, xerrors.Errorf("failed to parse agfl magic byte error: %08x", agfl.Magicnum)
+		}
 	}
-	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &agfl); err != nil {
+	agfl.Bno = make([]uint32, sb.AGFLSize())
+	if err := binary.Read(r, binary.BigEndian, agfl.Bno); err != nil {
 		return AGFL{}, xerrors.Errorf("failed to read agfl: %w", err)
 	}
-	if agfl.Magicnum != XFS_AGFL_MAGIC {
-		return AGFL{}, xerrors.Errorf("failed to parse agfl magic byte error: %08x", agfl.Magicnum)
-	}
 	return agfl, nil
 }
 
+// agSectors is the sectors of the AG headers, they are kept to be verified.
+type agSectors struct {
+	sb   []byte
+	agf  []byte
+	agi  []byte
+	agfl []byte
+}
+
+// ParseAG parses the AG headers, the superblock, AGF, AGI and AGFL are placed at each sector from the start of the AG.
+// https://github.com/torvalds/linux/blob/5bfc75d92efd494db37f5c4c173d3639d4772966/fs/xfs/libxfs/xfs_format.h
 func ParseAG(reader io.Reader) (*AG, error) {
-	var r io.Reader
+	ag, _, err := parseAG(reader)
+	return ag, err
+}
+
+func parseAG(reader io.Reader) (*AG, agSectors, error) {
 	var ag AG
 	var err error
-	r = io.LimitReader(reader, int64(utils.BlockSize))
+	// the sector size is not known until the superblock is read.
+	var sbSector bytes.Buffer
+	r := io.TeeReader(io.LimitReader(reader, XFS_MAX_SECTORSIZE), &sbSector)
 	ag.SuperBlock, err = parseSuperBlock(r)
 	if err != nil {
-		return nil, xerrors.Errorf("failed to parse super block: %w", err)
+		return nil, agSectors{}, xerrors.Errorf("failed to parse super block: %w", err)
 	}
 
-	sectorReader, err := utils.NewSectorReader(int(ag.SuperBlock.Sectsize))
-	if err != nil {
-		return nil, xerrors.Errorf("failed to create chunk reader: %w", err)
+	// the superblock sector has been read, read the sectors after it up to the AGFL.
+	sectSize := int(ag.SuperBlock.Sectsize)
+	buf := make([]byte, (XFS_AGFL_DADDR-XFS_SB_DADDR)*sectSize)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return nil, agSectors{}, xerrors.Errorf("failed to read ag headers: %w", err)
+	}
+	sector := func(daddr int) []byte {
+		offset := (daddr - XFS_SB_DADDR - 1) * sectSize
+		return buf[offset : offset+sectSize]
 	}
 
-	r = io.LimitReader(reader, int64(utils.BlockSize))
-	ag.Agf, err = parseAGF(sectorReader, r)
+	ag.Agf, err = parseAGF(sector(XFS_AGF_DADDR))
 	if err != nil {
-		return nil, xerrors.Errorf("failed to parse agf block: %w", err)
+		return nil, agSectors{}, xerrors.Errorf("failed to parse agf block: %w", err)
 	}
 
-	r = io.LimitReader(reader, int64(utils.BlockSize))
-	ag.Agi, err = parseAGI(sectorReader, r)
+	ag.Agi, err = parseAGI(sector(XFS_AGI_DADDR))
 	if err != nil {
-		return nil, xerrors.Errorf("failed to parse agi block: %w", err)
+		return nil, agSectors{}, xerrors.Errorf("failed to parse agi block: %w", err)
 	}
 
-	r = io.LimitReader(reader, int64(utils.BlockSize))
-	ag.Agfl, err = parseAGFL(sectorReader, r)
+	ag.Agfl, err = parseAGFL(ag.SuperBlock, sector(XFS_AGFL_DADDR))
 	if err != nil {
-		return nil, xerrors.Errorf("failed to parse agfl block: %w", err)
+		return nil, agSectors{}, xerrors.Errorf("failed to parse agfl block: %w", err)
 	}
 
-	return &ag, nil
+	return &ag, agSectors{
+		sb:   sbSector.Bytes(),
+		agf:  sector(XFS_AGF_DADDR),
+		agi:  sector(XFS_AGI_DADDR),
+		agfl: sector(XFS_AGFL_DADDR),
+	}, nil
 }
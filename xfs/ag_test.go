@@ -0,0 +1,60 @@
+package xfs
+
+import (
+	"testing"
+)
+
+func TestNewFS_SectorSize(t *testing.T) {
+	testCases := []struct {
+		name         string
+		sectSize     int
+		expectedAGFL int
+	}{
+		{
+			name:         "512 bytes sector",
+			sectSize:     512,
+			expectedAGFL: 119,
+		},
+		{
+			name:         "1024 bytes sector",
+			sectSize:     1024,
+			expectedAGFL: 247,
+		},
+		{
+			name:         "4096 bytes sector",
+			sectSize:     4096,
+			expectedAGFL: 1015,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			img := newTestImage(t, testImageOptions{sectSize: tt.sectSize})
+			img.file(img.root, "file", []byte("data"))
+			filesystem := img.fs()
+
+			if len(filesystem.AGs) != testAGCount {
+				t.Fatalf("name: %s, expected %d AGs, actual %d", tt.name, testAGCount, len(filesystem.AGs))
+			}
+			for i, ag := range filesystem.AGs {
+				if int(ag.SuperBlock.Sectsize) != tt.sectSize {
+					t.Fatalf("name: %s, expected sector size %d, actual %d", tt.name, tt.sectSize, ag.SuperBlock.Sectsize)
+				}
+				if ag.Agf.Seqno != uint32(i) || ag.Agi.Seqno != uint32(i) || ag.Agfl.Seqno != uint32(i) {
+					t.Fatalf("name: %s, expected seqno %d, actual %d, %d, %d", tt.name, i, ag.Agf.Seqno, ag.Agi.Seqno, ag.Agfl.Seqno)
+				}
+				if len(ag.Agfl.Bno) != tt.expectedAGFL {
+					t.Fatalf("name: %s, expected %d AGFL entries, actual %d", tt.name, tt.expectedAGFL, len(ag.Agfl.Bno))
+				}
+			}
+
+			buf, err := filesystem.ReadFile("file")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(buf) != "data" {
+				t.Fatalf("name: %s, expected %q, actual %q", tt.name, "data", buf)
+			}
+		})
+	}
+}
@@ -0,0 +1,395 @@
+package xfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/xerrors"
+)
+
+// Namespace prefixes of extended attribute names.
+// XFS calls the security namespace "secure", it is exposed as "security." same as Linux.
+const (
+	XattrUserPrefix     = "user."
+	XattrTrustedPrefix  = "trusted."
+	XattrSecurityPrefix = "security."
+)
+
+// https://github.com/torvalds/linux/blob/5bfc75d92efd494db37f5c4c173d3639d4772966/fs/xfs/libxfs/xfs_da_format.h
+
+// AttrShortformHdr is the header of the local format attribute fork, followed by Count shortform entries.
+// Each entry is namelen(u8), valuelen(u8), flags(u8), name and value.
+type AttrShortformHdr struct {
+	Totsize uint16
+	Count   uint8
+	Padding uint8
+}
+
+// AttrLeafMap is a free region of the attribute leaf block.
+type AttrLeafMap struct {
+	Base uint16
+	Size uint16
+}
+
+// Attr3LeafHdr is the header of XFS_ATTR3_LEAF_MAGIC blocks, followed by Count AttrLeafEntry.
+type Attr3LeafHdr struct {
+	Info      Da3Blkinfo
+	Count     uint16
+	Usedbytes uint16
+	Firstused uint16
+	Holes     uint8
+	Pad1      uint8
+	Freemap   [3]AttrLeafMap
+	Pad2      uint32
+}
+
+// AttrLeafEntry points the name and value at Nameidx of the leaf block.
+type AttrLeafEntry struct {
+	Hashval uint32
+	Nameidx uint16
+	Flags   uint8
+	Pad2    uint8
+}
+
+// Attr3RmtHdr is the header of every filesystem block of remote attribute values.
+type Attr3RmtHdr struct {
+	Magic  uint32
+	Offset uint32
+	Bytes  uint32
+	CRC    uint32
+	UUID   [16]byte
+	Owner  uint64
+	Blkno  uint64
+	Lsn    uint64
+}
+
+// attrEntry is an extended attribute, the value of remote entries is read on demand.
+type attrEntry struct {
+	flags uint8
+	name  string
+	value []byte
+
+	// remote value
+	valueBlk uint32
+	valueLen uint32
+}
+
+// Name returns the name with the namespace prefix.
+func (e attrEntry) Name() string {
+	switch {
+	case e.flags&XFS_ATTR_ROOT != 0:
+		return XattrTrustedPrefix + e.name
+	case e.flags&XFS_ATTR_SECURE != 0:
+		return XattrSecurityPrefix + e.name
+	default:
+		return XattrUserPrefix + e.name
+	}
+}
+
+func (e attrEntry) isRemote() bool {
+	return e.flags&XFS_ATTR_LOCAL == 0
+}
+
+// ListXattr returns the names of the extended attributes of the named file with the namespace prefix.
+func (xfs *FileSystem) ListXattr(name string) ([]string, error) {
+	const op = "listxattr"
+
+	inode, err := xfs.resolve(name, true)
+	if err != nil {
+		return nil, xfs.wrapError(op, name, xerrors.Errorf("failed to resolve path: %w", err))
+	}
+	entries, _, err := xfs.readAttrEntries(inode)
+	if err != nil {
+		return nil, xfs.wrapError(op, name, err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names, nil
+}
+
+// GetXattr returns the value of the extended attribute attr of the named file.
+// attr has the namespace prefix, e.g. "security.capability", ErrNoXattr is returned if it does not exist.
+func (xfs *FileSystem) GetXattr(name, attr string) ([]byte, error) {
+	const op = "getxattr"
+
+	inode, err := xfs.resolve(name, true)
+	if err != nil {
+		return nil, xfs.wrapError(op, name, xerrors.Errorf("failed to resolve path: %w", err))
+	}
+	value, err := xfs.getXattr(inode, attr)
+	if err != nil {
+		return nil, xfs.wrapError(op, name, err)
+	}
+	return value, nil
+}
+
+func (xfs *FileSystem) getXattr(inode *Inode, attr string) ([]byte, error) {
+	entries, bmap, err := xfs.readAttrEntries(inode)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Name() != attr {
+			continue
+		}
+		if !entry.isRemote() {
+			return append([]byte(nil), entry.value...), nil
+		}
+		value, err := xfs.readAttrRemoteValue(bmap, entry)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to read remote value of %s: %w", attr, err)
+		}
+		return value, nil
+	}
+	return nil, ErrNoXattr
+}
+
+// readAttrEntries returns the extended attributes in the attribute fork of the inode.
+// Incomplete entries and parent pointers are skipped.
+// https://github.com/torvalds/linux/blob/5bfc75d92efd494db37f5c4c173d3639d4772966/fs/xfs/libxfs/xfs_attr_leaf.c
+func (xfs *FileSystem) readAttrEntries(inode *Inode) ([]attrEntry, *blockMap, error) {
+	if inode.attributeFork == nil {
+		return nil, nil, nil
+	}
+
+	var entries []attrEntry
+	var bmap *blockMap
+	switch inode.inodeCore.Aformat {
+	case XFS_DINODE_FMT_LOCAL:
+		var err error
+		entries, err = parseAttrShortform(inode.attributeFork)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to parse shortform attributes: %w", err)
+		}
+	case XFS_DINODE_FMT_EXTENTS, XFS_DINODE_FMT_BTREE:
+		var err error
+		bmap, err = xfs.newAttrBlockMap(inode)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to read attribute fork: %w", err)
+		}
+		entries, err = xfs.readAttrLeafEntries(bmap)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to read attribute blocks: %w", err)
+		}
+	default:
+		return nil, nil, xerrors.Errorf("unsupported attribute fork format: %d", inode.inodeCore.Aformat)
+	}
+
+	var visible []attrEntry
+	for _, entry := range entries {
+		if entry.flags&(XFS_ATTR_INCOMPLETE|XFS_ATTR_PARENT) != 0 {
+			continue
+		}
+		visible = append(visible, entry)
+	}
+	return visible, bmap, nil
+}
+
+// newAttrBlockMap returns the blockMap of the attribute fork.
+func (xfs *FileSystem) newAttrBlockMap(inode *Inode) (*blockMap, error) {
+	r := bytes.NewReader(inode.attributeFork)
+	if inode.inodeCore.Aformat == XFS_DINODE_FMT_BTREE {
+		root, err := xfs.parseBmbrBlock(r, len(inode.attributeFork))
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse bmbt root: %w", err)
+		}
+		return &blockMap{fs: xfs, owner: inode.inodeCore.Ino, root: root}, nil
+	}
+	recs, err := xfs.parseBmbtRecs(r, inode.inodeCore.AttrExtents())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse bmbt recs: %w", err)
+	}
+	return xfs.newExtentsBlockMap(inode.inodeCore.Ino, recs), nil
+}
+
+func parseAttrShortform(buf []byte) ([]attrEntry, error) {
+	var hdr AttrShortformHdr
+	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &hdr); err != nil {
+		return nil, xerrors.Errorf("failed to read shortform header: %w", err)
+	}
+	if int(hdr.Totsize) > len(buf) {
+		return nil, xerrors.Errorf("invalid shortform total size: %d", hdr.Totsize)
+	}
+	buf = buf[:hdr.Totsize]
+
+	var entries []attrEntry
+	offset := int(unsafe.Sizeof(hdr))
+	for i := 0; i < int(hdr.Count); i++ {
+		if offset+3 > len(buf) {
+			return nil, xerrors.Errorf("invalid shortform entry offset: %d", offset)
+		}
+		namelen, valuelen, flags := int(buf[offset]), int(buf[offset+1]), buf[offset+2]
+		offset += 3
+		if offset+namelen+valuelen > len(buf) {
+			return nil, xerrors.Errorf("invalid shortform entry length: name(%d), value(%d)", namelen, valuelen)
+		}
+		entries = append(entries, attrEntry{
+			// shortform entries are always local, the flag is not set on disk.
+			flags: flags | XFS_ATTR_LOCAL,
+			name:  string(buf[offset : offset+namelen]),
+			value: buf[offset+namelen : offset+namelen+valuelen],
+		})
+		offset += namelen + valuelen
+	}
+	return entries, nil
+}
+
+// readAttrLeafEntries reads the entries of all leaf blocks of the attribute da-btree.
+// The da-btree starts at the logical block 0, node blocks are descended to the leftmost leaf and the leaves are followed by the forward link.
+func (xfs *FileSystem) readAttrLeafEntries(bmap *blockMap) ([]attrEntry, error) {
+	format := xfs.daFormat()
+	var block uint64
+	for depth := 0; ; depth++ {
+		if depth > XFS_DA_NODE_MAXDEPTH {
+			return nil, xerrors.Errorf("da-btree is deeper than %d", XFS_DA_NODE_MAXDEPTH)
+		}
+		buf, err := xfs.readDaBlock(bmap, block, 1)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to read attribute block %d: %w", block, err)
+		}
+		var info Da3Blkinfo
+		if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &info); err != nil {
+			return nil, xerrors.Errorf("failed to read da block info: %w", err)
+		}
+		if info.Magic == format.attrLeafMagic {
+			break
+		}
+		if info.Magic != format.nodeMagic {
+			return nil, xerrors.Errorf("unknown magic bytes: %x", info.Magic)
+		}
+		if count := binary.BigEndian.Uint16(buf[format.blkinfoSize:]); count == 0 {
+			return nil, xerrors.Errorf("empty da node at block %d", block)
+		}
+		var node DaNodeEntry
+		if err := binary.Read(bytes.NewReader(buf[format.nodeHdrSize:]), binary.BigEndian, &node); err != nil {
+			return nil, xerrors.Errorf("failed to read da node entry: %w", err)
+		}
+		block = uint64(node.Before)
+	}
+
+	var entries []attrEntry
+	visited := map[uint64]bool{}
+	for {
+		if visited[block] {
+			return nil, xerrors.Errorf("attribute leaf block %d is linked twice", block)
+		}
+		visited[block] = true
+
+		buf, err := xfs.readDaBlock(bmap, block, 1)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to read attribute block %d: %w", block, err)
+		}
+		leafEntries, forw, err := parseAttr3LeafBlock(buf, format)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse attribute leaf block %d: %w", block, err)
+		}
+		entries = append(entries, leafEntries...)
+		if forw == 0 {
+			return entries, nil
+		}
+		block = uint64(forw)
+	}
+}
+
+// parseAttr3LeafBlock returns the entries of the leaf block and the forward link.
+func parseAttr3LeafBlock(buf []byte, format daFormat) ([]attrEntry, uint32, error) {
+	var info Da3Blkinfo
+	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &info); err != nil {
+		return nil, 0, xerrors.Errorf("failed to read leaf header: %w", err)
+	}
+	if info.Magic != format.attrLeafMagic {
+		return nil, 0, xerrors.Errorf("unknown magic bytes: %x, expected %x", info.Magic, format.attrLeafMagic)
+	}
+	leafs := make([]AttrLeafEntry, binary.BigEndian.Uint16(buf[format.blkinfoSize:]))
+	if err := binary.Read(bytes.NewReader(buf[format.attrLeafHdrSize:]), binary.BigEndian, leafs); err != nil {
+		return nil, 0, xerrors.Errorf("failed to read leaf entries: %w", err)
+	}
+
+	var entries []attrEntry
+	for _, leaf := range leafs {
+		off := int(leaf.Nameidx)
+		entry := attrEntry{flags: leaf.Flags}
+		var namelen, nameOffset int
+		if leaf.Flags&XFS_ATTR_LOCAL != 0 {
+			// valuelen(be16), namelen(u8), name and value
+			if off+3 > len(buf) {
+				return nil, 0, xerrors.Errorf("invalid name index: %d", leaf.Nameidx)
+			}
+			valuelen := int(binary.BigEndian.Uint16(buf[off:]))
+			namelen, nameOffset = int(buf[off+2]), off+3
+			if nameOffset+namelen+valuelen > len(buf) {
+				return nil, 0, xerrors.Errorf("invalid local entry length: name(%d), value(%d)", namelen, valuelen)
+			}
+			entry.value = buf[nameOffset+namelen : nameOffset+namelen+valuelen]
+		} else {
+			// valueblk(be32), valuelen(be32), namelen(u8) and name
+			if off+9 > len(buf) {
+				return nil, 0, xerrors.Errorf("invalid name index: %d", leaf.Nameidx)
+			}
+			entry.valueBlk = binary.BigEndian.Uint32(buf[off:])
+			entry.valueLen = binary.BigEndian.Uint32(buf[off+4:])
+			namelen, nameOffset = int(buf[off+8]), off+9
+			if nameOffset+namelen > len(buf) {
+				return nil, 0, xerrors.Errorf("invalid remote entry name length: %d", namelen)
+			}
+		}
+		entry.name = string(buf[nameOffset : nameOffset+namelen])
+		entries = append(entries, entry)
+	}
+	return entries, info.Forw, nil
+}
+
+// readAttrRemoteValue reads the value stored in the remote value blocks, every block has Attr3RmtHdr.
+// The value of v4 filesystem is stored without the headers.
+func (xfs *FileSystem) readAttrRemoteValue(bmap *blockMap, entry attrEntry) ([]byte, error) {
+	blockSize := int(xfs.PrimaryAG.SuperBlock.BlockSize)
+	if !xfs.PrimaryAG.SuperBlock.HasCRC() {
+		count := (int(entry.valueLen) + blockSize - 1) / blockSize
+		buf, err := xfs.readLogicalBlocks(bmap, uint64(entry.valueBlk), uint64(count))
+		if err != nil {
+			return nil, xerrors.Errorf("failed to read remote value blocks: %w", err)
+		}
+		return buf[:entry.valueLen], nil
+	}
+	hdrSize := int(unsafe.Sizeof(Attr3RmtHdr{}))
+	dataSize := blockSize - hdrSize
+	count := (int(entry.valueLen) + dataSize - 1) / dataSize
+
+	buf, err := xfs.readLogicalBlocks(bmap, uint64(entry.valueBlk), uint64(count))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read remote value blocks: %w", err)
+	}
+
+	value := make([]byte, 0, entry.valueLen)
+	for i := 0; i < count; i++ {
+		block := buf[i*blockSize : (i+1)*blockSize]
+		var hdr Attr3RmtHdr
+		if err := binary.Read(bytes.NewReader(block), binary.BigEndian, &hdr); err != nil {
+			return nil, xerrors.Errorf("failed to read remote value header: %w", err)
+		}
+		if hdr.Magic != XFS_ATTR3_RMT_MAGIC {
+			return nil, xerrors.Errorf("unknown magic bytes: %x, expected XFS_ATTR3_RMT_MAGIC", hdr.Magic)
+		}
+		logicalBlock := uint64(entry.valueBlk) + uint64(i)
+		daddr, err := bmap.daddr(logicalBlock)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to lookup block %d: %w", logicalBlock, err)
+		}
+		what := fmt.Sprintf("remote value block %d of inode %d", logicalBlock, bmap.owner)
+		if err := xfs.verifyMetadata(what, block, rmtFields, daddr, bmap.owner); err != nil {
+			return nil, err
+		}
+		if int(hdr.Offset) != len(value) || int(hdr.Bytes) > dataSize || len(value)+int(hdr.Bytes) > int(entry.valueLen) {
+			return nil, xerrors.Errorf("invalid remote value header: offset(%d), bytes(%d)", hdr.Offset, hdr.Bytes)
+		}
+		value = append(value, block[hdrSize:hdrSize+int(hdr.Bytes)]...)
+	}
+	if len(value) != int(entry.valueLen) {
+		return nil, xerrors.Errorf(ErrReadSizeFormat, len(value), entry.valueLen)
+	}
+	return value, nil
+}
@@ -0,0 +1,248 @@
+package xfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseAttrShortform(t *testing.T) {
+	testCases := []struct {
+		name          string
+		buf           []byte
+		expectedNames []string
+		expectedErr   bool
+	}{
+		{
+			name: "namespaces",
+			buf: []byte{
+				0x00, 0x18, 0x03, 0x00, // totsize, count
+				0x01, 0x01, 0x00, 'a', '1', // user.a
+				0x01, 0x01, XFS_ATTR_ROOT, 'a', '2', // trusted.a
+				0x07, 0x00, XFS_ATTR_SECURE, 's', 'e', 'l', 'i', 'n', 'u', 'x', // security.selinux
+				0x00, 0x00, // padding of the fork
+			},
+			expectedNames: []string{"user.a", "trusted.a", "security.selinux"},
+		},
+		{
+			name: "entry exceeds totsize",
+			buf: []byte{
+				0x00, 0x08, 0x01, 0x00,
+				0x01, 0x04, 0x00, 'a', 'v', 'v', 'v', 'v',
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := parseAttrShortform(tt.buf)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("name: %s, expected error %v, actual %v", tt.name, tt.expectedErr, err)
+			}
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			if !reflect.DeepEqual(names, tt.expectedNames) {
+				t.Fatalf("name: %s, expected %v, actual %v", tt.name, tt.expectedNames, names)
+			}
+		})
+	}
+}
+
+func TestFileSystem_GetXattr(t *testing.T) {
+	local := []testXattr{
+		{name: "a", value: bytes.Repeat([]byte("a"), 100)},
+		{flags: XFS_ATTR_ROOT, name: "b", value: bytes.Repeat([]byte("b"), 100)},
+		{flags: XFS_ATTR_SECURE, name: "c", value: bytes.Repeat([]byte("c"), 100)},
+	}
+	remote := []testXattr{
+		{name: "small", value: []byte("value")},
+		// 3 remote value blocks with the headers and without them
+		{name: "large", value: bytes.Repeat([]byte("0123456789abcdef"), 640)},
+	}
+
+	testCases := []struct {
+		name     string
+		opts     testImageOptions
+		xattrs   []testXattr
+		attrNode bool
+	}{
+		{
+			name:   "v5 leaf",
+			opts:   testImageOptions{},
+			xattrs: local,
+		},
+		{
+			name:   "v4 leaf",
+			opts:   testImageOptions{v4: true},
+			xattrs: local,
+		},
+		{
+			name:     "v5 node",
+			opts:     testImageOptions{},
+			xattrs:   local,
+			attrNode: true,
+		},
+		{
+			name:     "v4 node",
+			opts:     testImageOptions{v4: true},
+			xattrs:   local,
+			attrNode: true,
+		},
+		{
+			name:   "v5 remote",
+			opts:   testImageOptions{},
+			xattrs: remote,
+		},
+		{
+			name:   "v4 remote",
+			opts:   testImageOptions{v4: true},
+			xattrs: remote,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			img := newTestImage(t, tt.opts)
+			file := img.file(img.root, "file", nil)
+			file.xattrs = tt.xattrs
+			file.attrNode = tt.attrNode
+			filesystem := img.fs(WithVerifyMode(VerifyStrict))
+
+			inode, err := filesystem.ParseInode(file.ino)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inode.inodeCore.Aformat != XFS_DINODE_FMT_EXTENTS {
+				t.Fatalf("name: %s, expected extents format, actual %d", tt.name, inode.inodeCore.Aformat)
+			}
+
+			names, err := filesystem.ListXattr("file")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var expectedNames []string
+			for _, x := range tt.xattrs {
+				name := attrEntry{flags: x.flags, name: x.name}.Name()
+				expectedNames = append(expectedNames, name)
+
+				value, err := filesystem.GetXattr("file", name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(value, x.value) {
+					t.Fatalf("name: %s, expected %s value %q, actual %q", tt.name, name, x.value, value)
+				}
+			}
+			sort.Strings(names)
+			sort.Strings(expectedNames)
+			if !reflect.DeepEqual(names, expectedNames) {
+				t.Fatalf("name: %s, expected %v, actual %v", tt.name, expectedNames, names)
+			}
+
+			if _, err := filesystem.GetXattr("file", "user.nothing"); !errors.Is(err, ErrNoXattr) {
+				t.Fatalf("name: %s, expected error %v, actual %v", tt.name, ErrNoXattr, err)
+			}
+		})
+	}
+}
+
+func TestFileSystem_GetXattrCorrupted(t *testing.T) {
+	local := []testXattr{
+		{name: "a", value: []byte("1")},
+		{name: "b", value: []byte("2")},
+		{name: "c", value: []byte("3")},
+	}
+	remote := []testXattr{
+		{name: "large", value: bytes.Repeat([]byte("0123456789abcdef"), 640)},
+	}
+
+	testCases := []struct {
+		name        string
+		xattrs      []testXattr
+		attr        string
+		block       uint64
+		corrupt     func(buf []byte)
+		expectedErr string
+	}{
+		{
+			// the da node points the leaf block 1, and the last leaf block 2 is linked back to it.
+			name:   "leaf linked twice",
+			xattrs: local,
+			attr:   "user.a",
+			block:  2,
+			corrupt: func(buf []byte) {
+				binary.BigEndian.PutUint32(buf[0:], 1)
+			},
+			expectedErr: "attribute leaf block 1 is linked twice",
+		},
+		{
+			name:   "remote value offset of the second block",
+			xattrs: remote,
+			attr:   "user.large",
+			block:  65,
+			corrupt: func(buf []byte) {
+				binary.BigEndian.PutUint32(buf[4:], 0)
+			},
+			expectedErr: "invalid remote value header",
+		},
+		{
+			name:   "remote value bytes of the last block",
+			xattrs: remote,
+			attr:   "user.large",
+			block:  66,
+			corrupt: func(buf []byte) {
+				binary.BigEndian.PutUint32(buf[8:], 3000)
+			},
+			expectedErr: "invalid remote value header",
+		},
+		{
+			name:   "remote value magic of the second block",
+			xattrs: remote,
+			attr:   "user.large",
+			block:  65,
+			corrupt: func(buf []byte) {
+				binary.BigEndian.PutUint32(buf[0:], 0)
+			},
+			expectedErr: "unknown magic bytes",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			img := newTestImage(t, testImageOptions{})
+			file := img.file(img.root, "file", nil)
+			file.xattrs = tt.xattrs
+			file.attrNode = true
+			filesystem := img.fs()
+
+			inode, err := filesystem.ParseInode(file.ino)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bmap, err := filesystem.newAttrBlockMap(inode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			extent, ok, err := bmap.lookup(tt.block)
+			if err != nil || !ok || extent.StartOff > tt.block {
+				t.Fatalf("name: %s, block %d is not mapped: %v", tt.name, tt.block, err)
+			}
+			buf := img.block(extent.StartBlock + tt.block - extent.StartOff)
+			tt.corrupt(buf)
+			// The checksum is correct, the blocks are rejected by the header checks.
+			setTestCRC(buf, XFS_ATTR3_RMT_CRC_OFF)
+
+			_, err = filesystem.GetXattr("file", tt.attr)
+			if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+				t.Fatalf("name: %s, expected error %q, actual %v", tt.name, tt.expectedErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package xfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/xerrors"
+)
+
+// blockMap maps the logical blocks of the data fork to extents.
+// The bmbt of btree format inodes is read lazily, only the blocks on the path to the looked up block are read.
+type blockMap struct {
+	fs *FileSystem
+	// owner is the inode number, the owner of the bmbt blocks and the mapped metadata blocks.
+	owner uint64
+
+	// extents format, sorted by the logical block
+	extents []BmbtIrec
+	// btree format
+	root *BmbrBlock
+
+	mu sync.Mutex
+	// leaf is the last read bmbt leaf block, sequential lookups hit it.
+	leaf *bmbtBlock
+}
+
+// bmbtBlock is the parsed on-disk bmbt block, node block has keys and ptrs and leaf block has recs.
+type bmbtBlock struct {
+	header BtreeBlock
+	keys   []BmbtKey
+	ptrs   []BmbtPtr
+	recs   []BmbtIrec
+}
+
+// newBlockMap returns the blockMap of the data fork.
+func (xfs *FileSystem) newBlockMap(inode *Inode) *blockMap {
+	owner := inode.inodeCore.Ino
+	switch {
+	case inode.directoryBtree != nil:
+		return &blockMap{fs: xfs, owner: owner, root: &inode.directoryBtree.bmbrBlock}
+	case inode.regularBtree != nil:
+		return &blockMap{fs: xfs, owner: owner, root: &inode.regularBtree.bmbrBlock}
+	case inode.directoryExtents != nil:
+		return xfs.newExtentsBlockMap(owner, inode.directoryExtents.bmbtRecs)
+	case inode.regularExtent != nil:
+		return xfs.newExtentsBlockMap(owner, inode.regularExtent.bmbtRecs)
+	}
+	return &blockMap{fs: xfs, owner: owner}
+}
+
+func (xfs *FileSystem) newExtentsBlockMap(owner uint64, recs []BmbtRec) *blockMap {
+	m := &blockMap{fs: xfs, owner: owner}
+	for _, rec := range recs {
+		m.extents = append(m.extents, rec.Unpack())
+	}
+	sort.Slice(m.extents, func(i, j int) bool { return m.extents[i].StartOff < m.extents[j].StartOff })
+	return m
+}
+
+// lookup returns the first extent which ends after the logical block.
+// The extent starts after block if block is in a hole, and ok is false if there is no extent after block.
+func (m *blockMap) lookup(block uint64) (BmbtIrec, bool, error) {
+	if m.root == nil {
+		i := searchExtents(m.extents, block)
+		if i == len(m.extents) {
+			return BmbtIrec{}, false, nil
+		}
+		return m.extents[i], true, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	leaf := m.leaf
+	if leaf == nil || len(leaf.recs) == 0 || leaf.recs[0].StartOff > block || searchExtents(leaf.recs, block) == len(leaf.recs) {
+		var err error
+		leaf, err = m.fs.lookupBmbtLeaf(m.root, block, m.owner)
+		if err != nil {
+			return BmbtIrec{}, false, xerrors.Errorf("failed to lookup bmbt leaf of block %d: %w", block, err)
+		}
+	}
+	for {
+		m.leaf = leaf
+		if i := searchExtents(leaf.recs, block); i < len(leaf.recs) {
+			return leaf.recs[i], true, nil
+		}
+		// block is after the last extent of the leaf, the next extent is in the right sibling.
+		if leaf.header.BbRightsib == NULLFSBLOCK {
+			return BmbtIrec{}, false, nil
+		}
+		next, err := m.fs.readBmbtBlock(uint64(leaf.header.BbRightsib), 0, m.owner)
+		if err != nil {
+			return BmbtIrec{}, false, xerrors.Errorf("failed to read right sibling: %w", err)
+		}
+		leaf = next
+	}
+}
+
+// all returns all extents sorted by the logical block, it reads all leaf blocks of btree format.
+func (m *blockMap) all() ([]BmbtIrec, error) {
+	if m.root == nil {
+		return m.extents, nil
+	}
+
+	leaf, err := m.fs.lookupBmbtLeaf(m.root, 0, m.owner)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to lookup the first bmbt leaf: %w", err)
+	}
+	var extents []BmbtIrec
+	for {
+		if len(extents) > 0 && len(leaf.recs) > 0 && leaf.recs[0].StartOff < extents[len(extents)-1].StartOff {
+			return nil, xerrors.Errorf("bmbt leaf blocks are not sorted: %d", leaf.recs[0].StartOff)
+		}
+		extents = append(extents, leaf.recs...)
+		if leaf.header.BbRightsib == NULLFSBLOCK {
+			return extents, nil
+		}
+		leaf, err = m.fs.readBmbtBlock(uint64(leaf.header.BbRightsib), 0, m.owner)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to read right sibling: %w", err)
+		}
+	}
+}
+
+// daddr returns the disk address of the logical block, it is the blkno in the self describing header of the block.
+func (m *blockMap) daddr(block uint64) (uint64, error) {
+	extent, ok, err := m.lookup(block)
+	if err != nil {
+		return 0, err
+	}
+	if !ok || extent.StartOff > block {
+		return 0, xerrors.Errorf("logical block %d is not mapped", block)
+	}
+	return m.fs.PrimaryAG.SuperBlock.BlockToDaddr(extent.StartBlock + block - extent.StartOff), nil
+}
+
+// searchExtents returns the index of the first extent which ends after block.
+func searchExtents(extents []BmbtIrec, block uint64) int {
+	return sort.Search(len(extents), func(i int) bool {
+		return extents[i].StartOff+extents[i].BlockCount > block
+	})
+}
+
+// lookupBmbtLeaf descends the bmbt from the root in the inode owner to the leaf block which may have block.
+func (xfs *FileSystem) lookupBmbtLeaf(root *BmbrBlock, block, owner uint64) (*bmbtBlock, error) {
+	if root.Level == 0 {
+		return nil, xerrors.New("invalid bmbt root level: 0")
+	}
+	level, keys, ptrs := root.Level, root.keys, root.ptrs
+	for {
+		// the last child whose first key is not after block
+		i := sort.Search(len(keys), func(i int) bool { return uint64(keys[i]) > block }) - 1
+		if i < 0 {
+			i = 0
+		}
+		if i >= len(ptrs) {
+			return nil, xerrors.Errorf("empty bmbt node at level %d", level)
+		}
+		node, err := xfs.readBmbtBlock(uint64(ptrs[i]), level-1, owner)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to read bmbt block at level %d: %w", level-1, err)
+		}
+		if node.header.Level == 0 {
+			return node, nil
+		}
+		level, keys, ptrs = node.header.Level, node.keys, node.ptrs
+	}
+}
+
+// readBmbtBlock reads the bmbt block at the filesystem block fsb, level is the expected tree level.
+// https://github.com/torvalds/linux/blob/5bfc75d92efd494db37f5c4c173d3639d4772966/fs/xfs/libxfs/xfs_bmap_btree.h
+func (xfs *FileSystem) readBmbtBlock(fsb uint64, level uint16, owner uint64) (*bmbtBlock, error) {
+	sb := xfs.PrimaryAG.SuperBlock
+	buf := make([]byte, sb.BlockSize)
+	physicalBlockOffset := sb.BlockToPhysicalOffset(fsb)
+	if _, err := xfs.r.ReadAt(buf, physicalBlockOffset*int64(sb.BlockSize)); err != nil {
+		return nil, xerrors.Errorf("failed to read block %d: %w", fsb, err)
+	}
+	what := fmt.Sprintf("bmbt block %d of inode %d", fsb, owner)
+	if err := xfs.verifyMetadata(what, buf, bmbtFields, sb.BlockToDaddr(fsb), owner); err != nil {
+		return nil, err
+	}
+
+	r := bytes.NewReader(buf)
+	header, err := xfs.parseBtreeBlock(r)
+	if err != nil {
+		return nil, xerrors.Errorf("parse btree block (block: %d) error: %w", fsb, err)
+	}
+	if header.Level != level {
+		return nil, xerrors.Errorf("invalid bmbt level: actual(%d), expected(%d)", header.Level, level)
+	}
+	block := &bmbtBlock{header: *header}
+
+	hdrSize := xfs.btreeBlockSize()
+	if header.Level == 0 {
+		if hdrSize+int(header.Numrecs)*int(unsafe.Sizeof(BmbtRec{})) > len(buf) {
+			return nil, xerrors.Errorf("invalid bmbt leaf numrecs: %d", header.Numrecs)
+		}
+		for i := uint16(0); i < header.Numrecs; i++ {
+			var rec BmbtRec
+			if err := binary.Read(r, binary.BigEndian, &rec); err != nil {
+				return nil, xerrors.Errorf("failed to read extents xfs_bmbt_irec: %w", err)
+			}
+			block.recs = append(block.recs, rec.Unpack())
+		}
+		return block, nil
+	}
+
+	// keys and ptrs of node blocks are placed as the block has maxrecs entries.
+	maxrecs := BmbrMaxRecs(len(buf) - hdrSize)
+	if int(header.Numrecs) > maxrecs {
+		return nil, xerrors.Errorf("invalid bmbt node numrecs: %d", header.Numrecs)
+	}
+	block.keys = make([]BmbtKey, header.Numrecs)
+	if err := binary.Read(bytes.NewReader(buf[hdrSize:]), binary.BigEndian, block.keys); err != nil {
+		return nil, xerrors.Errorf("failed to read bmbt keys: %w", err)
+	}
+	block.ptrs = make([]BmbtPtr, header.Numrecs)
+	if err := binary.Read(bytes.NewReader(buf[hdrSize+maxrecs*8:]), binary.BigEndian, block.ptrs); err != nil {
+		return nil, xerrors.Errorf("failed to read bmbt ptrs: %w", err)
+	}
+	return block, nil
+}
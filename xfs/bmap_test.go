@@ -0,0 +1,215 @@
+package xfs
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestBlockMap_lookup(t *testing.T) {
+	m := &blockMap{
+		extents: []BmbtIrec{
+			{StartOff: 2, StartBlock: 100, BlockCount: 3},
+			{StartOff: 5, StartBlock: 200, BlockCount: 1},
+			{StartOff: 10, StartBlock: 300, BlockCount: 2, State: XFS_EXT_UNWRITTEN},
+		},
+	}
+	testCases := []struct {
+		name             string
+		block            uint64
+		expectedOk       bool
+		expectedStartOff uint64
+	}{
+		{
+			name:             "hole before the first extent",
+			block:            0,
+			expectedOk:       true,
+			expectedStartOff: 2,
+		},
+		{
+			name:             "inside extent",
+			block:            4,
+			expectedOk:       true,
+			expectedStartOff: 2,
+		},
+		{
+			name:             "adjacent extent",
+			block:            5,
+			expectedOk:       true,
+			expectedStartOff: 5,
+		},
+		{
+			name:             "hole between extents",
+			block:            7,
+			expectedOk:       true,
+			expectedStartOff: 10,
+		},
+		{
+			name:       "after the last extent",
+			block:      12,
+			expectedOk: false,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			extent, ok, err := m.lookup(tt.block)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.expectedOk {
+				t.Fatalf("name: %s, expected ok %v, actual %v", tt.name, tt.expectedOk, ok)
+			}
+			if ok && extent.StartOff != tt.expectedStartOff {
+				t.Fatalf("name: %s, expected %d, actual %d", tt.name, tt.expectedStartOff, extent.StartOff)
+			}
+		})
+	}
+}
+
+func TestBlockMap_lookupBtree(t *testing.T) {
+	testCases := []struct {
+		name          string
+		opts          testImageOptions
+		extents       int
+		expectedLevel uint16
+	}{
+		{
+			name:          "root in the inode and 3 leaves",
+			extents:       600,
+			expectedLevel: 1,
+		},
+		{
+			// a leaf block has 27 records
+			name:          "root in the inode, a node and 23 leaves",
+			opts:          testImageOptions{blockSize: 512},
+			extents:       600,
+			expectedLevel: 2,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			// The even blocks are mapped and the odd blocks are holes.
+			img := newTestImage(t, tt.opts)
+			file := img.file(img.root, "sparse", nil)
+			for i := 0; i < tt.extents; i++ {
+				file.sparse = append(file.sparse, uint64(i*2))
+			}
+			filesystem := img.fs(WithVerifyMode(VerifyStrict))
+			blockSize := uint64(filesystem.PrimaryAG.SuperBlock.BlockSize)
+			// the last block of the first leaf
+			leafEnd := (blockSize-72)/16*2 - 1
+
+			inode, err := filesystem.ParseInode(file.ino)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inode.regularBtree == nil {
+				t.Fatalf("name: %s, expected btree format, actual %d", tt.name, inode.inodeCore.Format)
+			}
+			if inode.regularBtree.bmbrBlock.Level != tt.expectedLevel {
+				t.Fatalf("name: %s, expected level %d, actual %d", tt.name, tt.expectedLevel, inode.regularBtree.bmbrBlock.Level)
+			}
+			m := filesystem.newBlockMap(inode)
+			if m.leaf != nil {
+				t.Fatalf("name: %s, expected no leaf is read before lookup", tt.name)
+			}
+
+			last := uint64(tt.extents-1) * 2
+			steps := []struct {
+				name             string
+				block            uint64
+				expectedOk       bool
+				expectedStartOff uint64
+				expectedCached   bool
+			}{
+				{
+					name:             "descend to the first leaf",
+					block:            0,
+					expectedOk:       true,
+					expectedStartOff: 0,
+				},
+				{
+					name:             "cached leaf",
+					block:            10,
+					expectedOk:       true,
+					expectedStartOff: 10,
+					expectedCached:   true,
+				},
+				{
+					name:             "hole at the end of the leaf, walk to the right sibling",
+					block:            leafEnd,
+					expectedOk:       true,
+					expectedStartOff: leafEnd + 1,
+				},
+				{
+					name:             "cached right sibling",
+					block:            leafEnd + 2,
+					expectedOk:       true,
+					expectedStartOff: leafEnd + 3,
+					expectedCached:   true,
+				},
+				{
+					name:             "descend to the last leaf",
+					block:            last,
+					expectedOk:       true,
+					expectedStartOff: last,
+				},
+				{
+					name:             "descend backwards",
+					block:            3,
+					expectedOk:       true,
+					expectedStartOff: 4,
+				},
+				{
+					name:       "after the last extent, right sibling is NULLFSBLOCK",
+					block:      last + 1,
+					expectedOk: false,
+				},
+			}
+			for _, step := range steps {
+				prev := m.leaf
+				extent, ok, err := m.lookup(step.block)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ok != step.expectedOk {
+					t.Fatalf("name: %s, expected ok %v, actual %v", step.name, step.expectedOk, ok)
+				}
+				if ok && extent.StartOff != step.expectedStartOff {
+					t.Fatalf("name: %s, expected %d, actual %d", step.name, step.expectedStartOff, extent.StartOff)
+				}
+				if cached := prev != nil && prev == m.leaf; cached != step.expectedCached {
+					t.Fatalf("name: %s, expected cached %v, actual %v", step.name, step.expectedCached, cached)
+				}
+			}
+
+			extents, err := m.all()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(extents) != tt.extents {
+				t.Fatalf("name: %s, expected %d extents, actual %d", tt.name, tt.extents, len(extents))
+			}
+			for i, extent := range extents {
+				if extent.StartOff != uint64(i*2) || extent.BlockCount != 1 {
+					t.Fatalf("name: %s, expected extent at %d, actual %+v", tt.name, i*2, extent)
+				}
+			}
+
+			buf, err := filesystem.ReadFile("sparse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for block := uint64(0); block <= last; block++ {
+				expected := block
+				if block%2 == 1 {
+					expected = 0
+				}
+				if actual := binary.BigEndian.Uint64(buf[block*blockSize:]); actual != expected {
+					t.Fatalf("name: %s, expected %d at block %d, actual %d", tt.name, expected, block, actual)
+				}
+			}
+		})
+	}
+}
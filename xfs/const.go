@@ -4,11 +4,23 @@ const (
 	BMBT_EXNTFLAG_BITLEN = 1
 	INODEV3_SIZE         = 176
 	INODE_SIZE           = 96
+	INODEV2_SIZE         = INODE_SIZE + 4 // v1 and v2 inode cores end at di_next_unlinked
 	LEAF_ENTRY_SIZE      = 8
 
+	// header sizes of v4 directory and attribute blocks
+	DA_BLKINFO_SIZE    = 12
+	DIR2_DATA_HDR_SIZE = 16
+	DIR2_LEAF_HDR_SIZE = DA_BLKINFO_SIZE + 4
+	DA_NODE_HDR_SIZE   = DA_BLKINFO_SIZE + 4
+	ATTR_LEAF_HDR_SIZE = 32
+
 	XFS_DIR2_DATA_FD_COUNT  = 3
 	XFS_DIR2_DATA_FREE_TAG  = 0xffff
 	XFS_DIR2_DATA_ALIGN_LOG = 3
+	XFS_DIR2_NULL_DATAPTR   = 0
+	XFS_DA_NODE_MAXDEPTH    = 5
+
+	NULLFSBLOCK = -1
 
 	XFS_SB_MAGIC         = 0x58465342
 	XFS_AGF_MAGIC        = 0x58414746
@@ -25,7 +37,7 @@ const (
 	XFS_IBT_CRC_MAGIC    = 0x49414233
 	XFS_FIBT_MAGIC       = 0x46494254
 	XFS_FIBT_CRC_MAGIC   = 0x46494233
-	XFS_BMAP_MAGICa      = 0x424d4150
+	XFS_BMAP_MAGIC       = 0x424d4150
 	XFS_BMAP_CRC_MAGIC   = 0x424d4133
 	XFS_DA_NODE_MAGIC    = 0xfebe
 	XFS_DA3_NODE_MAGIC   = 0x3ebe
@@ -46,6 +58,59 @@ const (
 	XFS_RTRMAP_CRC_MAGIC = 0x4d415052
 	XFS_REFC_CRC_MAGIC   = 0x52334643
 	XFS_MD_MAGIC         = 0x5846534d
+
+	// offsets of the CRC in v5 metadata
+	XFS_SB_CRC_OFF           = 224
+	XFS_AGF_CRC_OFF          = 216
+	XFS_AGI_CRC_OFF          = 312
+	XFS_AGFL_CRC_OFF         = 32
+	XFS_DINODE_CRC_OFF       = 100
+	XFS_BTREE_LBLOCK_CRC_OFF = 64
+	XFS_DIR3_DATA_CRC_OFF    = 4
+	XFS_DA3_NODE_CRC_OFF     = 12
+	XFS_ATTR3_RMT_CRC_OFF    = 12
+
+	// Deprecated: use XFS_BMAP_MAGIC.
+	XFS_BMAP_MAGICa = XFS_BMAP_MAGIC
+)
+
+const (
+	// block and sector size limits of xfs_sb_good_version
+	XFS_MIN_BLOCKSIZE_LOG  = 9  /* i.e. 512 bytes */
+	XFS_MAX_BLOCKSIZE_LOG  = 16 /* i.e. 65536 bytes */
+	XFS_MIN_SECTORSIZE_LOG = 9  /* i.e. 512 bytes */
+	XFS_MAX_SECTORSIZE_LOG = 15 /* i.e. 32768 bytes */
+	XFS_MAX_SECTORSIZE     = 1 << XFS_MAX_SECTORSIZE_LOG
+
+	// the unit of the disk address, blkno of the self describing headers
+	BBSHIFT = 9
+
+	// AG header positions in sectors from the start of the AG
+	XFS_SB_DADDR   = 0
+	XFS_AGF_DADDR  = 1
+	XFS_AGI_DADDR  = 2
+	XFS_AGFL_DADDR = 3
+
+	// inode size limits
+	XFS_DINODE_MIN_LOG = 8  /* i.e. 256 bytes */
+	XFS_DINODE_MAX_LOG = 11 /* i.e. 2048 bytes */
+
+	XFS_SB_VERSION_NUMBITS = 0x000f
+	XFS_SB_VERSION_4       = 4
+	XFS_SB_VERSION_5       = 5
+
+	XFS_SB_VERSION_ATTRBIT     = 0x0010
+	XFS_SB_VERSION_NLINKBIT    = 0x0020
+	XFS_SB_VERSION_QUOTABIT    = 0x0040
+	XFS_SB_VERSION_ALIGNBIT    = 0x0080
+	XFS_SB_VERSION_DALIGNBIT   = 0x0100
+	XFS_SB_VERSION_SHAREDBIT   = 0x0200
+	XFS_SB_VERSION_LOGV2BIT    = 0x0400
+	XFS_SB_VERSION_SECTORBIT   = 0x0800
+	XFS_SB_VERSION_EXTFLGBIT   = 0x1000
+	XFS_SB_VERSION_DIRV2BIT    = 0x2000
+	XFS_SB_VERSION_BORGBIT     = 0x4000 /* ASCII only case-insens. */
+	XFS_SB_VERSION_MOREBITSBIT = 0x8000 /* sb_features2 is valid */
 )
 
 const (
@@ -59,12 +124,107 @@ const (
 	XFS_SB_VERSION2_FTYPE          = 0x00000200 /* inode type in dir */
 )
 
+const (
+	XFS_SB_FEAT_RO_COMPAT_FINOBT   = 1 << 0 /* free inode btree */
+	XFS_SB_FEAT_RO_COMPAT_RMAPBT   = 1 << 1 /* reverse map btree */
+	XFS_SB_FEAT_RO_COMPAT_REFLINK  = 1 << 2 /* reflinked files */
+	XFS_SB_FEAT_RO_COMPAT_INOBTCNT = 1 << 3 /* inobt block counts */
+
+	XFS_SB_FEAT_INCOMPAT_FTYPE       = 1 << 0  /* filetype in dirent */
+	XFS_SB_FEAT_INCOMPAT_SPINODES    = 1 << 1  /* sparse inode chunks */
+	XFS_SB_FEAT_INCOMPAT_META_UUID   = 1 << 2  /* metadata UUID */
+	XFS_SB_FEAT_INCOMPAT_BIGTIME     = 1 << 3  /* large timestamps */
+	XFS_SB_FEAT_INCOMPAT_NEEDSREPAIR = 1 << 4  /* needs xfs_repair */
+	XFS_SB_FEAT_INCOMPAT_NREXT64     = 1 << 5  /* large extent counters */
+	XFS_SB_FEAT_INCOMPAT_EXCHRANGE   = 1 << 6  /* exchangerange supported */
+	XFS_SB_FEAT_INCOMPAT_PARENT      = 1 << 7  /* parent pointers */
+	XFS_SB_FEAT_INCOMPAT_METADIR     = 1 << 8  /* metadata dir tree */
+	XFS_SB_FEAT_INCOMPAT_ZONED       = 1 << 9  /* zoned RT allocator */
+	XFS_SB_FEAT_INCOMPAT_ZONE_GAPS   = 1 << 10 /* RTGs have LBA gaps */
+
+	XFS_SB_FEAT_INCOMPAT_LOG_XATTRS = 1 << 0 /* Delayed Attributes */
+)
+
+const (
+	// di_flags2
+	XFS_DIFLAG2_DAX        = 1 << 0 /* use DAX for this inode */
+	XFS_DIFLAG2_REFLINK    = 1 << 1 /* file's blocks may be shared */
+	XFS_DIFLAG2_COWEXTSIZE = 1 << 2 /* copy on write extent size hint */
+	XFS_DIFLAG2_BIGTIME    = 1 << 3 /* big timestamps */
+	XFS_DIFLAG2_NREXT64    = 1 << 4 /* large extent counters */
+
+	// bigtime counts nanoseconds since the minimum 32-bit timestamp (1901-12-13)
+	XFS_BIGTIME_EPOCH_OFFSET = int64(1) << 31
+)
+
 const (
 	XFS_DIR2_DATA_SPACE int64 = iota
 	XFS_DIR2_LEAF_SPACE
 	XFS_DIR2_FREE_SPACE
 )
 
+const (
+	// file types in directory entries
+	XFS_DIR3_FT_UNKNOWN = iota
+	XFS_DIR3_FT_REG_FILE
+	XFS_DIR3_FT_DIR
+	XFS_DIR3_FT_CHRDEV
+	XFS_DIR3_FT_BLKDEV
+	XFS_DIR3_FT_FIFO
+	XFS_DIR3_FT_SOCK
+	XFS_DIR3_FT_SYMLINK
+	XFS_DIR3_FT_WHT
+)
+
+const (
+	// xfs_attr_leaf_entry flags
+	XFS_ATTR_LOCAL      = 1 << 0 /* attr value is in the leaf block */
+	XFS_ATTR_ROOT       = 1 << 1 /* trusted namespace */
+	XFS_ATTR_SECURE     = 1 << 2 /* security namespace */
+	XFS_ATTR_PARENT     = 1 << 3 /* parent pointer */
+	XFS_ATTR_INCOMPLETE = 1 << 7 /* attr in the middle of create/delete */
+)
+
+const (
+	// xfs_acl_entry tags
+	ACL_USER_OBJ  = 0x01
+	ACL_USER      = 0x02
+	ACL_GROUP_OBJ = 0x04
+	ACL_GROUP     = 0x08
+	ACL_MASK      = 0x10
+	ACL_OTHER     = 0x20
+
+	// xfs_acl_entry permissions
+	ACL_READ    = 0x04
+	ACL_WRITE   = 0x02
+	ACL_EXECUTE = 0x01
+
+	ACL_UNDEFINED_ID = 0xffffffff
+
+	// attribute names of ACLs in the trusted namespace
+	SGI_ACL_FILE    = "SGI_ACL_FILE"
+	SGI_ACL_DEFAULT = "SGI_ACL_DEFAULT"
+)
+
+const (
+	// vfs_cap_data magic_etc, stored in little endian
+	VFS_CAP_REVISION_MASK   = 0xFF000000
+	VFS_CAP_REVISION_1      = 0x01000000
+	VFS_CAP_REVISION_2      = 0x02000000
+	VFS_CAP_REVISION_3      = 0x03000000
+	VFS_CAP_FLAGS_EFFECTIVE = 0x000001
+
+	XATTR_CAPS_SZ_1 = 4 + 4*2*1
+	XATTR_CAPS_SZ_2 = 4 + 4*2*2
+	XATTR_CAPS_SZ_3 = XATTR_CAPS_SZ_2 + 4
+)
+
+const (
+	// typedef enum xfs_exntst
+	XFS_EXT_NORM = iota
+	XFS_EXT_UNWRITTEN
+)
+
 const (
 	// typedef enum xfs_dinode_fmt
 	XFS_DINODE_FMT_DEV = iota
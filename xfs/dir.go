@@ -0,0 +1,458 @@
+package xfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/fs"
+	"math/bits"
+	"path"
+	"sort"
+	"unsafe"
+
+	"golang.org/x/xerrors"
+)
+
+// Dir is implemented io/fs ReadDirFile interface.
+// Dir reads entries lazily, one directory block at a time, so huge directories
+// can be listed with bounded memory.
+type Dir struct {
+	fs *FileSystem
+	FileInfo
+
+	// cookie is the position of the next entry, it is the same as the telldir offset of XFS.
+	// https://github.com/torvalds/linux/blob/5bfc75d92efd494db37f5c4c173d3639d4772966/fs/xfs/libxfs/xfs_da_format.h
+	cookie  uint32
+	eof     bool
+	entries []cookieEntry
+	bmap    *blockMap
+}
+
+type cookieEntry struct {
+	Entry
+	cookie uint32
+}
+
+// OpenDir opens the named directory for streaming reads.
+func (xfs *FileSystem) OpenDir(name string) (*Dir, error) {
+	const op = "opendir"
+
+	inode, err := xfs.resolve(name, true)
+	if err != nil {
+		return nil, xfs.wrapError(op, name, xerrors.Errorf("failed to resolve path: %w", err))
+	}
+	if !inode.inodeCore.IsDir() {
+		return nil, xfs.wrapError(op, name, xerrors.Errorf("%s is file, directory: %w", name, fs.ErrNotExist))
+	}
+	return xfs.newDir(FileInfo{
+		name:  path.Base(name),
+		inode: inode,
+	}), nil
+}
+
+func (xfs *FileSystem) newDir(info FileInfo) *Dir {
+	d := &Dir{
+		fs:       xfs,
+		FileInfo: info,
+	}
+
+	d.bmap = xfs.newBlockMap(info.inode)
+	return d
+}
+
+func (d *Dir) Stat() (fs.FileInfo, error) {
+	return &d.FileInfo, nil
+}
+
+func (d *Dir) Read(_ []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.Name(), Err: ErrIsDir}
+}
+
+// ReadDir reads the contents of the directory, see fs.ReadDirFile.
+// Entries are returned in on-disk order, not sorted by name.
+func (d *Dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	var dirEntries []fs.DirEntry
+	for n <= 0 || len(dirEntries) < n {
+		entry, err := d.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return dirEntries, &fs.PathError{Op: "readdir", Path: d.Name(), Err: err}
+		}
+		dirEntries = append(dirEntries, d.fs.newDirEntry(entry))
+	}
+	if n > 0 && len(dirEntries) == 0 {
+		return nil, io.EOF
+	}
+	return dirEntries, nil
+}
+
+// Tell returns the cookie of the next entry, like telldir(3).
+// The cookie stays valid across Dir instances of the same directory.
+func (d *Dir) Tell() uint32 {
+	return d.cookie
+}
+
+// Seekdir moves to the entry of cookie returned by Tell, like seekdir(3).
+func (d *Dir) Seekdir(cookie uint32) {
+	d.cookie = cookie
+	d.eof = false
+	d.entries = nil
+}
+
+func (d *Dir) Close() error {
+	return nil
+}
+
+// next returns the next entry except "." and "..", or io.EOF.
+func (d *Dir) next() (Entry, error) {
+	for {
+		if len(d.entries) == 0 {
+			if d.eof {
+				return nil, io.EOF
+			}
+			if err := d.fill(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		entry := d.entries[0]
+		d.entries = d.entries[1:]
+		d.cookie = entry.cookie + 1
+		if entry.Name() == "." || entry.Name() == ".." {
+			continue
+		}
+		return entry.Entry, nil
+	}
+}
+
+// fill reads the directory block which has the entry of the current cookie.
+func (d *Dir) fill() error {
+	inode := d.inode
+	if inode.directoryLocal != nil {
+		for _, entry := range inode.directoryLocal.entries {
+			cookie := uint32(binary.BigEndian.Uint16(entry.Offset[:]) >> XFS_DIR2_DATA_ALIGN_LOG)
+			if cookie >= d.cookie {
+				d.entries = append(d.entries, cookieEntry{Entry: entry, cookie: cookie})
+			}
+		}
+		d.eof = true
+		return nil
+	}
+
+	sb := d.fs.PrimaryAG.SuperBlock
+	dirBlockSize := int64(sb.DirBlockSize())
+	leafBlock := uint64(XFS_DIR2_LEAF_OFFSET / int64(sb.BlockSize))
+	for {
+		// the logical block of the directory block which has the cookie
+		offset := int64(d.cookie) << XFS_DIR2_DATA_ALIGN_LOG
+		block := uint64(offset/dirBlockSize*dirBlockSize) / uint64(sb.BlockSize)
+
+		block, ok, err := d.bmap.nextMappedBlock(block)
+		if err != nil {
+			return xerrors.Errorf("failed to lookup directory block %d: %w", block, err)
+		}
+		if !ok || block >= leafBlock {
+			d.eof = true
+			return nil
+		}
+		blockOffset := int64(block) * int64(sb.BlockSize)
+		if blockOffset > offset {
+			d.cookie = uint32(blockOffset >> XFS_DIR2_DATA_ALIGN_LOG)
+		}
+
+		entries, err := d.fs.readDir2DataBlock(d.bmap, block)
+		if err != nil {
+			return xerrors.Errorf("failed to read directory block %d: %w", block, err)
+		}
+		for _, entry := range entries {
+			cookie := uint32((blockOffset + int64(entry.Tag)) >> XFS_DIR2_DATA_ALIGN_LOG)
+			if cookie >= d.cookie {
+				d.entries = append(d.entries, cookieEntry{Entry: entry, cookie: cookie})
+			}
+		}
+		if len(d.entries) > 0 {
+			return nil
+		}
+		// skip to the next directory block
+		d.cookie = uint32((blockOffset + dirBlockSize) >> XFS_DIR2_DATA_ALIGN_LOG)
+	}
+}
+
+// nextMappedBlock returns the first mapped logical block at or after block.
+func (m *blockMap) nextMappedBlock(block uint64) (uint64, bool, error) {
+	extent, ok, err := m.lookup(block)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	return max(block, extent.StartOff), true, nil
+}
+
+// readLogicalBlocks reads count blocks from the logical block of the file mapped by bmap.
+func (xfs *FileSystem) readLogicalBlocks(bmap *blockMap, block uint64, count uint64) ([]byte, error) {
+	buf := make([]byte, 0, count*uint64(xfs.PrimaryAG.SuperBlock.BlockSize))
+	for count > 0 {
+		extent, ok, err := bmap.lookup(block)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to lookup logical block %d: %w", block, err)
+		}
+		if !ok || extent.StartOff > block {
+			return nil, xerrors.Errorf("logical block %d is not mapped", block)
+		}
+		n := extent.StartOff + extent.BlockCount - block
+		if n > count {
+			n = count
+		}
+		physicalBlockOffset := xfs.PrimaryAG.SuperBlock.BlockToPhysicalOffset(extent.StartBlock + block - extent.StartOff)
+		if _, err := xfs.seekBlock(physicalBlockOffset); err != nil {
+			return nil, xerrors.Errorf("failed to seek block: %w", err)
+		}
+		b, err := xfs.readBlock(uint32(n))
+		if err != nil {
+			return nil, xerrors.Errorf("failed to read block: %w", err)
+		}
+		buf = append(buf, b...)
+		block += n
+		count -= n
+	}
+	return buf, nil
+}
+
+// daFormat is the magic numbers and the header sizes of directory and attribute blocks.
+// v5 filesystem has the self describing headers, v4 filesystem has the shorter ones.
+// https://github.com/torvalds/linux/blob/5bfc75d92efd494db37f5c4c173d3639d4772966/fs/xfs/libxfs/xfs_da_format.h
+type daFormat struct {
+	dataMagic     uint32
+	blockMagic    uint32
+	leaf1Magic    uint16
+	leafnMagic    uint16
+	nodeMagic     uint16
+	attrLeafMagic uint16
+
+	// the count of leaf, node and attribute leaf blocks follows the blkinfo.
+	blkinfoSize     int
+	dataHdrSize     int
+	leafHdrSize     int
+	nodeHdrSize     int
+	attrLeafHdrSize int
+}
+
+func (xfs *FileSystem) daFormat() daFormat {
+	if xfs.PrimaryAG.SuperBlock.HasCRC() {
+		return daFormat{
+			dataMagic:       XFS_DIR3_DATA_MAGIC,
+			blockMagic:      XFS_DIR3_BLOCK_MAGIC,
+			leaf1Magic:      XFS_DIR3_LEAF1_MAGIC,
+			leafnMagic:      XFS_DIR3_LEAFN_MAGIC,
+			nodeMagic:       XFS_DA3_NODE_MAGIC,
+			attrLeafMagic:   XFS_ATTR3_LEAF_MAGIC,
+			blkinfoSize:     binary.Size(Da3Blkinfo{}),
+			dataHdrSize:     binary.Size(Dir3DataHdr{}),
+			leafHdrSize:     binary.Size(Dir3LeafHdr{}),
+			nodeHdrSize:     binary.Size(Da3NodeHdr{}),
+			attrLeafHdrSize: binary.Size(Attr3LeafHdr{}),
+		}
+	}
+	return daFormat{
+		dataMagic:       XFS_DIR2_DATA_MAGIC,
+		blockMagic:      XFS_DIR2_BLOCK_MAGIC,
+		leaf1Magic:      XFS_DIR2_LEAF1_MAGIC,
+		leafnMagic:      XFS_DIR2_LEAFN_MAGIC,
+		nodeMagic:       XFS_DA_NODE_MAGIC,
+		attrLeafMagic:   XFS_ATTR_LEAF_MAGIC,
+		blkinfoSize:     DA_BLKINFO_SIZE,
+		dataHdrSize:     DIR2_DATA_HDR_SIZE,
+		leafHdrSize:     DIR2_LEAF_HDR_SIZE,
+		nodeHdrSize:     DA_NODE_HDR_SIZE,
+		attrLeafHdrSize: ATTR_LEAF_HDR_SIZE,
+	}
+}
+
+// readDir2DataBlock reads the directory data block starts at the logical block, and returns its entries.
+func (xfs *FileSystem) readDir2DataBlock(bmap *blockMap, block uint64) ([]Dir2DataEntry, error) {
+	sb := xfs.PrimaryAG.SuperBlock
+	buf, err := xfs.readDaBlock(bmap, block, uint64(sb.DirBlockSize()/sb.BlockSize))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read directory block: %w", err)
+	}
+
+	format := xfs.daFormat()
+	if len(buf) < format.dataHdrSize {
+		return nil, xerrors.Errorf("invalid directory block size: %d", len(buf))
+	}
+	reader := bytes.NewReader(buf[format.dataHdrSize:])
+	switch magic := binary.BigEndian.Uint32(buf); magic {
+	case format.dataMagic:
+		return xfs.parseXDD3Block(reader)
+	case format.blockMagic:
+		return xfs.parseXDB3Block(reader)
+	default:
+		return nil, xerrors.Errorf("unknown magic bytes: %x", magic)
+	}
+}
+
+// DaHashname returns the hash of name used by directory and attribute da-btrees.
+// https://github.com/torvalds/linux/blob/5bfc75d92efd494db37f5c4c173d3639d4772966/fs/xfs/libxfs/xfs_da_btree.c
+func DaHashname(name []byte) uint32 {
+	var hash uint32
+	for ; len(name) >= 4; name = name[4:] {
+		hash = uint32(name[0])<<21 ^ uint32(name[1])<<14 ^ uint32(name[2])<<7 ^ uint32(name[3]) ^
+			bits.RotateLeft32(hash, 7*4)
+	}
+	switch len(name) {
+	case 3:
+		return uint32(name[0])<<14 ^ uint32(name[1])<<7 ^ uint32(name[2]) ^ bits.RotateLeft32(hash, 7*3)
+	case 2:
+		return uint32(name[0])<<7 ^ uint32(name[1]) ^ bits.RotateLeft32(hash, 7*2)
+	case 1:
+		return uint32(name[0]) ^ bits.RotateLeft32(hash, 7*1)
+	default:
+		return hash
+	}
+}
+
+// lookup returns the inode number of the entry named name in the directory.
+// Block, leaf and node directories are searched by the hash of name through their leaf entries,
+// so only the blocks on the way to the entry are read.
+func (xfs *FileSystem) lookup(dir *Inode, name string) (uint64, error) {
+	if dir.directoryLocal != nil {
+		for _, entry := range dir.directoryLocal.entries {
+			if entry.Name() == name {
+				return entry.InodeNumber(), nil
+			}
+		}
+		return 0, fs.ErrNotExist
+	}
+
+	bmap := xfs.newBlockMap(dir)
+	format := xfs.daFormat()
+	sb := xfs.PrimaryAG.SuperBlock
+	dirBlocks := uint64(sb.DirBlockSize() / sb.BlockSize)
+	leafBlock := uint64(XFS_DIR2_LEAF_OFFSET / int64(sb.BlockSize))
+	hash := DaHashname([]byte(name))
+
+	block, ok, err := bmap.nextMappedBlock(leafBlock)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to lookup leaf block: %w", err)
+	}
+	if !ok || block != leafBlock {
+		// Block directory, the leaf entries are placed before the tail of the single directory block.
+		buf, err := xfs.readDaBlock(bmap, 0, dirBlocks)
+		if err != nil {
+			return 0, xerrors.Errorf("failed to read directory block: %w", err)
+		}
+		if magic := binary.BigEndian.Uint32(buf); magic != format.blockMagic {
+			return 0, xerrors.Errorf("unknown magic bytes: %x, expected %x", magic, format.blockMagic)
+		}
+		var tail Dir2BlockTail
+		tailOffset := len(buf) - int(unsafe.Sizeof(tail))
+		if err := binary.Read(bytes.NewReader(buf[tailOffset:]), binary.BigEndian, &tail); err != nil {
+			return 0, xerrors.Errorf("failed to read tail binary: %w", err)
+		}
+		leafOffset := tailOffset - int(tail.Count)*LEAF_ENTRY_SIZE
+		if leafOffset < 0 {
+			return 0, xerrors.Errorf("invalid leaf count: %d", tail.Count)
+		}
+		leafs := make([]Dir2LeafEntry, tail.Count)
+		if err := binary.Read(bytes.NewReader(buf[leafOffset:tailOffset]), binary.BigEndian, leafs); err != nil {
+			return 0, xerrors.Errorf("failed to read leaf entries: %w", err)
+		}
+		ino, _, err := xfs.lookupLeafEntries(bmap, leafs, hash, name)
+		return ino, err
+	}
+
+	for depth := 0; ; depth++ {
+		if depth > XFS_DA_NODE_MAXDEPTH {
+			return 0, xerrors.Errorf("da-btree is deeper than %d", XFS_DA_NODE_MAXDEPTH)
+		}
+		buf, err := xfs.readDaBlock(bmap, block, dirBlocks)
+		if err != nil {
+			return 0, xerrors.Errorf("failed to read directory block %d: %w", block, err)
+		}
+		// Forw, Back and Magic are placed at the same offsets in v4 and v5 blkinfo.
+		var info Da3Blkinfo
+		if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &info); err != nil {
+			return 0, xerrors.Errorf("failed to read da block info: %w", err)
+		}
+		count := binary.BigEndian.Uint16(buf[format.blkinfoSize:])
+		switch info.Magic {
+		case format.nodeMagic:
+			nodes := make([]DaNodeEntry, count)
+			if err := binary.Read(bytes.NewReader(buf[format.nodeHdrSize:]), binary.BigEndian, nodes); err != nil {
+				return 0, xerrors.Errorf("failed to read da node entries: %w", err)
+			}
+			// the first child which may have hash, same hashes may continue to its siblings.
+			i := sort.Search(len(nodes), func(i int) bool { return nodes[i].Hashval >= hash })
+			if i == len(nodes) {
+				return 0, fs.ErrNotExist
+			}
+			block = uint64(nodes[i].Before)
+		case format.leaf1Magic, format.leafnMagic:
+			leafs := make([]Dir2LeafEntry, count)
+			if err := binary.Read(bytes.NewReader(buf[format.leafHdrSize:]), binary.BigEndian, leafs); err != nil {
+				return 0, xerrors.Errorf("failed to read leaf entries: %w", err)
+			}
+			ino, more, err := xfs.lookupLeafEntries(bmap, leafs, hash, name)
+			if !xerrors.Is(err, fs.ErrNotExist) || !more || info.Forw == 0 {
+				return ino, err
+			}
+			// hash collisions continue to the next leaf block
+			block = uint64(info.Forw)
+		default:
+			return 0, xerrors.Errorf("unknown magic bytes: %x", info.Magic)
+		}
+	}
+}
+
+// lookupLeafEntries finds name from the leaf entries sorted by hash.
+// more reports whether the entries of the same hash may continue to the next leaf block.
+func (xfs *FileSystem) lookupLeafEntries(bmap *blockMap, leafs []Dir2LeafEntry, hash uint32, name string) (uint64, bool, error) {
+	i := sort.Search(len(leafs), func(i int) bool { return leafs[i].Hashval >= hash })
+	for ; i < len(leafs) && leafs[i].Hashval == hash; i++ {
+		if leafs[i].Address == XFS_DIR2_NULL_DATAPTR {
+			// stale entry
+			continue
+		}
+		entry, err := xfs.readDir2DataEntryAt(bmap, leafs[i].Address)
+		if err != nil {
+			return 0, false, xerrors.Errorf("failed to read directory entry: %w", err)
+		}
+		if entry.Name() == name {
+			return entry.InodeNumber(), false, nil
+		}
+	}
+	return 0, i == len(leafs), fs.ErrNotExist
+}
+
+// readDir2DataEntryAt reads the data entry of the address, address is the byte offset >> XFS_DIR2_DATA_ALIGN_LOG.
+func (xfs *FileSystem) readDir2DataEntryAt(bmap *blockMap, address uint32) (*Dir2DataEntry, error) {
+	sb := xfs.PrimaryAG.SuperBlock
+	dirBlockSize := int64(sb.DirBlockSize())
+	offset := int64(address) << XFS_DIR2_DATA_ALIGN_LOG
+	blockOffset := offset / dirBlockSize * dirBlockSize
+
+	buf, err := xfs.readDaBlock(bmap, uint64(blockOffset)/uint64(sb.BlockSize), uint64(sb.DirBlockSize()/sb.BlockSize))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read directory block: %w", err)
+	}
+	off := int(offset - blockOffset)
+	if off+int(unsafe.Sizeof(uint64(0)))+1 > len(buf) {
+		return nil, xerrors.Errorf("invalid entry address: %d", address)
+	}
+	entry := Dir2DataEntry{
+		Inumber: binary.BigEndian.Uint64(buf[off:]),
+		Namelen: buf[off+8],
+		Tag:     uint16(off),
+	}
+	nameOffset := off + 9
+	if nameOffset+int(entry.Namelen)+1 > len(buf) {
+		return nil, xerrors.Errorf("invalid entry name length: %d", entry.Namelen)
+	}
+	entry.EntryName = string(buf[nameOffset : nameOffset+int(entry.Namelen)])
+	if sb.HasFtype() {
+		entry.Filetype = buf[nameOffset+int(entry.Namelen)]
+	}
+	return &entry, nil
+}
@@ -0,0 +1,53 @@
+package xfs_test
+
+import (
+	"testing"
+
+	"github.com/masahiro331/go-xfs-filesystem/xfs"
+)
+
+func TestDaHashname(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected uint32
+	}{
+		{
+			name:     "empty",
+			input:    "",
+			expected: 0,
+		},
+		{
+			name:     "dot",
+			input:    ".",
+			expected: 0x2e,
+		},
+		{
+			name:     "dot dot",
+			input:    "..",
+			expected: 0x172e,
+		},
+		{
+			name:     "four characters",
+			input:    "abcd",
+			expected: 0x0c38b1e4,
+		},
+		{
+			/*
+				"abcd" => 0x0c38b1e4
+				rol32(0x0c38b1e4, 7) ^ 'e' = 0x1c58f206 ^ 0x65 = 0x1c58f263
+			*/
+			name:     "five characters",
+			input:    "abcde",
+			expected: 0x1c58f263,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := xfs.DaHashname([]byte(tt.input))
+			if got != tt.expected {
+				t.Errorf("DaHashname(%q) got = %#x, want %#x", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
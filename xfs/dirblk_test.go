@@ -0,0 +1,105 @@
+package xfs
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestFileSystem_ReadDirDirblklog(t *testing.T) {
+	testCases := []struct {
+		name      string
+		opts      testImageOptions
+		dirFormat string
+		children  int
+	}{
+		{
+			name:      "block of 2 filesystem blocks",
+			opts:      testImageOptions{blockSize: 512, dirBlkLog: 1},
+			dirFormat: "block",
+			children:  20,
+		},
+		{
+			name:      "leaf of 4 filesystem blocks",
+			opts:      testImageOptions{blockSize: 512, dirBlkLog: 2},
+			dirFormat: "leaf",
+			children:  100,
+		},
+		{
+			name:      "node of 2 filesystem blocks",
+			opts:      testImageOptions{blockSize: 512, dirBlkLog: 1},
+			dirFormat: "node",
+			children:  200,
+		},
+		{
+			name:      "v4 block of 2 filesystem blocks",
+			opts:      testImageOptions{v4: true, blockSize: 512, dirBlkLog: 1},
+			dirFormat: "block",
+			children:  20,
+		},
+		{
+			name:      "v4 node of 4 filesystem blocks",
+			opts:      testImageOptions{v4: true, blockSize: 512, dirBlkLog: 2},
+			dirFormat: "node",
+			children:  300,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			img := newTestImage(t, tt.opts)
+			dir := img.mkdir(img.root, "dir")
+			// every filesystem block of the directory blocks is a separate extent
+			dir.fragment = true
+			dir.dirFormat = tt.dirFormat
+			var expected []string
+			for i := 0; i < tt.children; i++ {
+				name := fmt.Sprintf("file-%03d", i)
+				img.file(dir, name, []byte(name))
+				expected = append(expected, name)
+			}
+			filesystem := img.fs(WithVerifyMode(VerifyStrict))
+
+			inode, err := filesystem.ParseInode(dir.ino)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectedSize := filesystem.PrimaryAG.SuperBlock.BlockSize << tt.opts.dirBlkLog
+			if dirBlockSize := filesystem.PrimaryAG.SuperBlock.DirBlockSize(); dirBlockSize != expectedSize {
+				t.Fatalf("name: %s, expected directory block size %d, actual %d", tt.name, expectedSize, dirBlockSize)
+			}
+			if inode.directoryExtents == nil && inode.directoryBtree == nil {
+				t.Fatalf("name: %s, expected extents or btree format, actual %d", tt.name, inode.inodeCore.Format)
+			}
+
+			entries, err := filesystem.ReadDir("dir")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			sort.Strings(names)
+			if len(names) != len(expected) {
+				t.Fatalf("name: %s, expected %d entries, actual %d", tt.name, len(expected), len(names))
+			}
+			for i := range names {
+				if names[i] != expected[i] {
+					t.Fatalf("name: %s, expected %s, actual %s", tt.name, expected[i], names[i])
+				}
+			}
+
+			// lookup reads the data block of the entry by the leaf address
+			for _, name := range []string{expected[0], expected[len(expected)/2], expected[len(expected)-1]} {
+				buf, err := filesystem.ReadFile("dir/" + name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(buf) != name {
+					t.Fatalf("name: %s, expected %q, actual %q", tt.name, name, buf)
+				}
+			}
+		})
+	}
+}
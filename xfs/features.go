@@ -0,0 +1,158 @@
+package xfs
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrUnsupportedFeature is wrapped by UnsupportedFeatureError.
+var ErrUnsupportedFeature = xerrors.New("unsupported feature")
+
+// UnsupportedFeatureError is returned by NewFS for the filesystem which has the features this package can't read.
+type UnsupportedFeatureError struct {
+	Features []string
+}
+
+func (e *UnsupportedFeatureError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrUnsupportedFeature, strings.Join(e.Features, ", "))
+}
+
+func (e *UnsupportedFeatureError) Unwrap() error {
+	return ErrUnsupportedFeature
+}
+
+type featureBit struct {
+	mask uint32
+	name string
+}
+
+// The names are the same as xfs_info and mkfs.xfs options.
+// https://github.com/torvalds/linux/blob/5bfc75d92efd494db37f5c4c173d3639d4772966/fs/xfs/libxfs/xfs_format.h
+var (
+	versionFeatures = []featureBit{
+		{XFS_SB_VERSION_ATTRBIT, "attr"},
+		{XFS_SB_VERSION_NLINKBIT, "nlink"},
+		{XFS_SB_VERSION_QUOTABIT, "quota"},
+		{XFS_SB_VERSION_ALIGNBIT, "align"},
+		{XFS_SB_VERSION_DALIGNBIT, "dalign"},
+		{XFS_SB_VERSION_SHAREDBIT, "shared"},
+		{XFS_SB_VERSION_LOGV2BIT, "logv2"},
+		{XFS_SB_VERSION_SECTORBIT, "sector"},
+		{XFS_SB_VERSION_EXTFLGBIT, "extflg"},
+		{XFS_SB_VERSION_DIRV2BIT, "dirv2"},
+		{XFS_SB_VERSION_BORGBIT, "asciici"},
+	}
+	features2Features = []featureBit{
+		{XFS_SB_VERSION2_LAZYSBCOUNTBIT, "lazy-count"},
+		{XFS_SB_VERSION2_ATTR2BIT, "attr2"},
+		{XFS_SB_VERSION2_PARENTBIT, "parent"},
+		{XFS_SB_VERSION2_PROJID32BIT, "projid32bit"},
+		{XFS_SB_VERSION2_CRCBIT, "crc"},
+		{XFS_SB_VERSION2_FTYPE, "ftype"},
+	}
+	roCompatFeatures = []featureBit{
+		{XFS_SB_FEAT_RO_COMPAT_FINOBT, "finobt"},
+		{XFS_SB_FEAT_RO_COMPAT_RMAPBT, "rmapbt"},
+		{XFS_SB_FEAT_RO_COMPAT_REFLINK, "reflink"},
+		{XFS_SB_FEAT_RO_COMPAT_INOBTCNT, "inobtcount"},
+	}
+	incompatFeatures = []featureBit{
+		{XFS_SB_FEAT_INCOMPAT_FTYPE, "ftype"},
+		{XFS_SB_FEAT_INCOMPAT_SPINODES, "sparse"},
+		{XFS_SB_FEAT_INCOMPAT_META_UUID, "meta_uuid"},
+		{XFS_SB_FEAT_INCOMPAT_BIGTIME, "bigtime"},
+		{XFS_SB_FEAT_INCOMPAT_NEEDSREPAIR, "needsrepair"},
+		{XFS_SB_FEAT_INCOMPAT_NREXT64, "nrext64"},
+		{XFS_SB_FEAT_INCOMPAT_EXCHRANGE, "exchange"},
+		{XFS_SB_FEAT_INCOMPAT_PARENT, "parent"},
+		{XFS_SB_FEAT_INCOMPAT_METADIR, "metadir"},
+		{XFS_SB_FEAT_INCOMPAT_ZONED, "zoned"},
+		{XFS_SB_FEAT_INCOMPAT_ZONE_GAPS, "zone_gaps"},
+	}
+	logIncompatFeatures = []featureBit{
+		{XFS_SB_FEAT_INCOMPAT_LOG_XATTRS, "log_xattrs"},
+	}
+)
+
+// supportedIncompat is the incompat features this package can read, the others change the on-disk format of files.
+// needsrepair is set while xfs_repair is rewriting the filesystem and zoned files are on the realtime device.
+const supportedIncompat = XFS_SB_FEAT_INCOMPAT_FTYPE |
+	XFS_SB_FEAT_INCOMPAT_SPINODES |
+	XFS_SB_FEAT_INCOMPAT_META_UUID |
+	XFS_SB_FEAT_INCOMPAT_BIGTIME |
+	XFS_SB_FEAT_INCOMPAT_NREXT64 |
+	XFS_SB_FEAT_INCOMPAT_EXCHRANGE |
+	XFS_SB_FEAT_INCOMPAT_PARENT |
+	XFS_SB_FEAT_INCOMPAT_METADIR
+
+// Features returns the names of the features enabled on the filesystem, e.g. "crc", "finobt", "reflink".
+// Unknown bits are named by the field and the bit, e.g. "incompat_0x800".
+func (sb SuperBlock) Features() []string {
+	var names []string
+	if sb.HasCRC() {
+		// v5 filesystem always has the v4 features up to crc, features2 is not used.
+		// versionnum still has the ascii-ci feature, mkfs.xfs -n version=ci.
+		names = append(names, "crc")
+		names = append(names, decodeFeatures(versionFeatures, uint32(sb.Versionnum&XFS_SB_VERSION_BORGBIT), "version")...)
+	} else {
+		names = append(names, decodeFeatures(versionFeatures, uint32(sb.Versionnum&^(XFS_SB_VERSION_NUMBITS|XFS_SB_VERSION_MOREBITSBIT)), "version")...)
+		if sb.Versionnum&XFS_SB_VERSION_MOREBITSBIT != 0 {
+			names = append(names, decodeFeatures(features2Features, sb.Features2, "features2")...)
+		}
+		return names
+	}
+	names = append(names, decodeFeatures(nil, sb.FeaturesCompat, "compat")...)
+	names = append(names, decodeFeatures(roCompatFeatures, sb.FeaturesRoCompat, "ro_compat")...)
+	names = append(names, decodeFeatures(incompatFeatures, sb.FeaturesIncompat, "incompat")...)
+	names = append(names, decodeFeatures(logIncompatFeatures, sb.FeaturesLogIncompat, "log_incompat")...)
+	return names
+}
+
+func decodeFeatures(table []featureBit, bits uint32, field string) []string {
+	var names []string
+	for _, f := range table {
+		if bits&f.mask != 0 {
+			names = append(names, f.name)
+			bits &^= f.mask
+		}
+	}
+	for ; bits != 0; bits &= bits - 1 {
+		names = append(names, fmt.Sprintf("%s_%#x", field, bits&-bits))
+	}
+	return names
+}
+
+// checkFeatures returns UnsupportedFeatureError if the filesystem has the features this package can't read.
+// Unknown compat and ro_compat features don't change the format of files, the filesystem can be read.
+// https://github.com/torvalds/linux/blob/5bfc75d92efd494db37f5c4c173d3639d4772966/fs/xfs/libxfs/xfs_sb.c
+func (sb SuperBlock) checkFeatures() error {
+	var unsupported []string
+	switch sb.Version() {
+	case XFS_SB_VERSION_4:
+		const known = XFS_SB_VERSION_NUMBITS | XFS_SB_VERSION_ATTRBIT | XFS_SB_VERSION_NLINKBIT |
+			XFS_SB_VERSION_QUOTABIT | XFS_SB_VERSION_ALIGNBIT | XFS_SB_VERSION_DALIGNBIT |
+			XFS_SB_VERSION_LOGV2BIT | XFS_SB_VERSION_SECTORBIT | XFS_SB_VERSION_EXTFLGBIT |
+			XFS_SB_VERSION_DIRV2BIT | XFS_SB_VERSION_MOREBITSBIT
+		if sb.Versionnum&XFS_SB_VERSION_DIRV2BIT == 0 {
+			unsupported = append(unsupported, "dirv1")
+		}
+		unsupported = append(unsupported, decodeFeatures(versionFeatures, uint32(sb.Versionnum&^known), "version")...)
+		if sb.Versionnum&XFS_SB_VERSION_MOREBITSBIT != 0 {
+			const known2 = XFS_SB_VERSION2_LAZYSBCOUNTBIT | XFS_SB_VERSION2_ATTR2BIT |
+				XFS_SB_VERSION2_PROJID32BIT | XFS_SB_VERSION2_FTYPE
+			unsupported = append(unsupported, decodeFeatures(features2Features, sb.Features2&^known2, "features2")...)
+		}
+	case XFS_SB_VERSION_5:
+		// The directory entries of ascii-ci filesystem are hashed by the lower case name.
+		unsupported = decodeFeatures(versionFeatures, uint32(sb.Versionnum&XFS_SB_VERSION_BORGBIT), "version")
+		unsupported = append(unsupported, decodeFeatures(incompatFeatures, sb.FeaturesIncompat&^supportedIncompat, "incompat")...)
+	default:
+		unsupported = append(unsupported, fmt.Sprintf("version %d", sb.Version()))
+	}
+	if len(unsupported) > 0 {
+		return &UnsupportedFeatureError{Features: unsupported}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package xfs
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestSuperBlock_Features(t *testing.T) {
+	testCases := []struct {
+		name                string
+		sb                  SuperBlock
+		expectedFeatures    []string
+		expectedUnsupported []string
+	}{
+		{
+			name: "v5 default",
+			sb: SuperBlock{
+				Versionnum:       XFS_SB_VERSION_5,
+				FeaturesRoCompat: XFS_SB_FEAT_RO_COMPAT_FINOBT | XFS_SB_FEAT_RO_COMPAT_REFLINK,
+				FeaturesIncompat: XFS_SB_FEAT_INCOMPAT_FTYPE | XFS_SB_FEAT_INCOMPAT_SPINODES | XFS_SB_FEAT_INCOMPAT_BIGTIME,
+			},
+			expectedFeatures: []string{"crc", "finobt", "reflink", "ftype", "sparse", "bigtime"},
+		},
+		{
+			name: "v5 unknown ro_compat",
+			sb: SuperBlock{
+				Versionnum:       XFS_SB_VERSION_5,
+				FeaturesRoCompat: 1 << 8,
+			},
+			expectedFeatures: []string{"crc", "ro_compat_0x100"},
+		},
+		{
+			name: "v5 needsrepair and unknown incompat",
+			sb: SuperBlock{
+				Versionnum:       XFS_SB_VERSION_5,
+				FeaturesIncompat: XFS_SB_FEAT_INCOMPAT_FTYPE | XFS_SB_FEAT_INCOMPAT_NEEDSREPAIR | 1<<20,
+			},
+			expectedFeatures:    []string{"crc", "ftype", "needsrepair", "incompat_0x100000"},
+			expectedUnsupported: []string{"needsrepair", "incompat_0x100000"},
+		},
+		{
+			name: "v5 ascii-ci",
+			sb: SuperBlock{
+				Versionnum:       XFS_SB_VERSION_5 | XFS_SB_VERSION_BORGBIT,
+				FeaturesIncompat: XFS_SB_FEAT_INCOMPAT_FTYPE,
+			},
+			expectedFeatures:    []string{"crc", "asciici", "ftype"},
+			expectedUnsupported: []string{"asciici"},
+		},
+		{
+			name: "v4 with features2",
+			sb: SuperBlock{
+				Versionnum: XFS_SB_VERSION_4 | XFS_SB_VERSION_NLINKBIT | XFS_SB_VERSION_EXTFLGBIT |
+					XFS_SB_VERSION_DIRV2BIT | XFS_SB_VERSION_MOREBITSBIT,
+				Features2: XFS_SB_VERSION2_LAZYSBCOUNTBIT | XFS_SB_VERSION2_ATTR2BIT,
+			},
+			expectedFeatures: []string{"nlink", "extflg", "dirv2", "lazy-count", "attr2"},
+		},
+		{
+			name: "v4 ascii-ci",
+			sb: SuperBlock{
+				Versionnum: XFS_SB_VERSION_4 | XFS_SB_VERSION_DIRV2BIT | XFS_SB_VERSION_BORGBIT,
+			},
+			expectedFeatures:    []string{"dirv2", "asciici"},
+			expectedUnsupported: []string{"asciici"},
+		},
+		{
+			name: "v4 dirv1",
+			sb: SuperBlock{
+				Versionnum: XFS_SB_VERSION_4 | XFS_SB_VERSION_SHAREDBIT,
+			},
+			expectedFeatures:    []string{"shared"},
+			expectedUnsupported: []string{"dirv1", "shared"},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sb.Features(); !reflect.DeepEqual(got, tt.expectedFeatures) {
+				t.Fatalf("name: %s, expected %v, actual %v", tt.name, tt.expectedFeatures, got)
+			}
+			err := tt.sb.checkFeatures()
+			if tt.expectedUnsupported == nil {
+				if err != nil {
+					t.Fatalf("name: %s, unexpected error: %s", tt.name, err)
+				}
+				return
+			}
+			var featureErr *UnsupportedFeatureError
+			if !xerrors.As(err, &featureErr) || !xerrors.Is(err, ErrUnsupportedFeature) {
+				t.Fatalf("name: %s, expected UnsupportedFeatureError, actual %v", tt.name, err)
+			}
+			if !reflect.DeepEqual(featureErr.Features, tt.expectedUnsupported) {
+				t.Fatalf("name: %s, expected %v, actual %v", tt.name, tt.expectedUnsupported, featureErr.Features)
+			}
+		})
+	}
+}
+
+func TestNewFS_UnsupportedFeature(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts testImageOptions
+	}{
+		{
+			name: "v5 ascii-ci",
+			opts: testImageOptions{
+				versionnum: XFS_SB_VERSION_5 | XFS_SB_VERSION_NLINKBIT | XFS_SB_VERSION_ALIGNBIT |
+					XFS_SB_VERSION_DIRV2BIT | XFS_SB_VERSION_MOREBITSBIT | XFS_SB_VERSION_BORGBIT,
+			},
+		},
+		{
+			name: "v5 unknown incompat",
+			opts: testImageOptions{incompat: 1 << 20},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			img := newTestImage(t, tt.opts).build()
+			_, err := NewFS(*io.NewSectionReader(bytes.NewReader(img), 0, int64(len(img))), nil)
+			if !xerrors.Is(err, ErrUnsupportedFeature) {
+				t.Fatalf("name: %s, expected %v, actual %v", tt.name, ErrUnsupportedFeature, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,1126 @@
+package xfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"math/bits"
+	"sort"
+	"testing"
+	"time"
+)
+
+// testImage builds small synthetic XFS images, it writes the structures the same way as mkfs.xfs and the kernel.
+// The inode chunks and the data blocks are allocated sequentially, no free space btree is written.
+type testImage struct {
+	t    testing.TB
+	opts testImageOptions
+
+	img       []byte
+	blockSize int
+	inodeSize int
+	sectSize  int
+	blocklog  uint
+	agblklog  uint
+	inopblock int
+	inopblog  uint
+	coreSize  int
+	next      []uint32
+	inodes    []*testInode
+	freeSlots []uint64
+	chunkAG   int
+	dataAG    int
+	root      *testInode
+}
+
+type testImageOptions struct {
+	blockSize int
+	inodeSize int
+	sectSize  int
+	dirBlkLog int
+	v4        bool
+	noFtype   bool
+	// versionnum replaces the versionnum of mkfs.xfs when it is set.
+	versionnum uint16
+	// incompat is added to the incompatible features of a v5 superblock.
+	incompat uint32
+	// metaUUID is stamped in the metadata instead of the filesystem UUID when it is set.
+	metaUUID []byte
+}
+
+type testInode struct {
+	ino   uint64
+	mode  uint16
+	nlink uint32
+	rdev  uint32
+	mtime time.Time
+
+	data []byte
+	// fragment allocates each block of the data fork separately.
+	fragment bool
+	// sparse maps only the logical blocks of a regular file, each block is a separate extent and
+	// starts with its logical block number.
+	sparse []uint64
+	target string
+	xattrs []testXattr
+	// attrNode forces the node format of the attribute fork.
+	attrNode bool
+	// dirFormat forces "block", "leaf" or "node" format of the directory.
+	dirFormat string
+	// forkoff forces the attribute fork offset, it is in 8 bytes units.
+	forkoff int
+
+	children []testDirent
+	parent   *testInode
+}
+
+type testDirent struct {
+	name string
+	ino  *testInode
+}
+
+type testXattr struct {
+	flags uint8
+	name  string
+	value []byte
+}
+
+// testFork is the literal area of a fork.
+type testFork struct {
+	format   uint8
+	content  []byte
+	nextents int
+}
+
+// testRec is an extent of a fork, off and fsb are in filesystem blocks.
+type testRec struct {
+	off, fsb, len uint64
+}
+
+const (
+	testAGCount  = 2
+	testAGBlocks = 2048
+)
+
+var testUUID = [16]byte{'0', '1', '2', '3', '4', '5', '6', '7', '8', '9', 'a', 'b', 'c', 'd', 'e', 'f'}
+
+func newTestImage(t testing.TB, opts testImageOptions) *testImage {
+	t.Helper()
+
+	if opts.blockSize == 0 {
+		opts.blockSize = 4096
+	}
+	if opts.inodeSize == 0 {
+		opts.inodeSize = 512
+		if opts.v4 {
+			opts.inodeSize = 256
+		}
+	}
+	if opts.sectSize == 0 {
+		opts.sectSize = 512
+	}
+	b := &testImage{t: t, opts: opts, blockSize: opts.blockSize, inodeSize: opts.inodeSize, sectSize: opts.sectSize}
+	b.blocklog = uint(bits.TrailingZeros(uint(b.blockSize)))
+	b.agblklog = uint(bits.Len(uint(testAGBlocks - 1)))
+	b.inopblock = b.blockSize / b.inodeSize
+	b.inopblog = uint(bits.TrailingZeros(uint(b.inopblock)))
+	b.img = make([]byte, testAGCount*testAGBlocks*b.blockSize)
+	b.next = make([]uint32, testAGCount)
+	hdrBlocks := (4*b.sectSize + b.blockSize - 1) / b.blockSize
+	for i := range b.next {
+		b.next[i] = uint32(hdrBlocks + 4)
+	}
+	b.coreSize = 176
+	if opts.v4 {
+		b.coreSize = 100
+	}
+	b.root = b.newInode(0o40755)
+	b.root.parent = b.root
+	b.root.nlink = 2
+	return b
+}
+
+func (b *testImage) newInode(mode uint16) *testInode {
+	if len(b.freeSlots) == 0 {
+		ag := b.chunkAG % testAGCount
+		b.chunkAG++
+		nblocks := (64 + b.inopblock - 1) / b.inopblock
+		agbno := b.alloc(ag, nblocks)
+		for i := 0; i < nblocks*b.inopblock; i++ {
+			bno := uint64(agbno) + uint64(i/b.inopblock)
+			ino := uint64(ag)<<(b.agblklog+b.inopblog) | bno<<b.inopblog | uint64(i%b.inopblock)
+			b.freeSlots = append(b.freeSlots, ino)
+		}
+	}
+	ino := b.freeSlots[0]
+	b.freeSlots = b.freeSlots[1:]
+	in := &testInode{
+		ino:   ino,
+		mode:  mode,
+		nlink: 1,
+		mtime: time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC),
+	}
+	b.inodes = append(b.inodes, in)
+	return in
+}
+
+func (b *testImage) alloc(ag int, n int) uint32 {
+	s := b.next[ag]
+	if int(s)+n > testAGBlocks {
+		b.t.Fatalf("allocation group %d is full", ag)
+	}
+	b.next[ag] += uint32(n)
+	return s
+}
+
+// allocData allocates n contiguous blocks, the allocation groups are used in turn and
+// a block is left free after each allocation, so the extents are never merged.
+func (b *testImage) allocData(n int) uint64 {
+	ag := b.dataAG % testAGCount
+	b.dataAG++
+	agbno := b.alloc(ag, n)
+	b.alloc(ag, 1)
+	return uint64(ag)<<b.agblklog | uint64(agbno)
+}
+
+func (b *testImage) fsbOffset(fsb uint64) int {
+	ag := fsb >> b.agblklog
+	agbno := fsb & (1<<b.agblklog - 1)
+	return int((ag*testAGBlocks + agbno) * uint64(b.blockSize))
+}
+
+// daddr returns the disk address of the block in 512 bytes units.
+func (b *testImage) daddr(fsb uint64) uint64 {
+	return uint64(b.fsbOffset(fsb)) >> 9
+}
+
+func (b *testImage) block(fsb uint64) []byte {
+	off := b.fsbOffset(fsb)
+	return b.img[off : off+b.blockSize]
+}
+
+func (b *testImage) add(dir *testInode, name string, in *testInode) *testInode {
+	dir.children = append(dir.children, testDirent{name, in})
+	in.parent = dir
+	return in
+}
+
+func (b *testImage) mkdir(dir *testInode, name string) *testInode {
+	in := b.add(dir, name, b.newInode(0o40755))
+	in.nlink = 2
+	return in
+}
+
+func (b *testImage) file(dir *testInode, name string, data []byte) *testInode {
+	in := b.add(dir, name, b.newInode(0o100644))
+	in.data = data
+	return in
+}
+
+func (b *testImage) symlink(dir *testInode, name, target string) *testInode {
+	in := b.add(dir, name, b.newInode(0o120777))
+	in.target = target
+	return in
+}
+
+func (b *testImage) node(dir *testInode, name string, mode uint16, rdev uint32) *testInode {
+	in := b.add(dir, name, b.newInode(mode))
+	in.rdev = rdev
+	return in
+}
+
+// build writes all inodes and the allocation group headers, and returns the image.
+func (b *testImage) build() []byte {
+	b.t.Helper()
+
+	for _, in := range b.inodes {
+		b.writeInode(in)
+	}
+	b.writeHeaders()
+	return b.img
+}
+
+// fs builds the image and opens it.
+// uuid returns the UUID stamped in the metadata.
+func (b *testImage) uuid() []byte {
+	if b.opts.metaUUID != nil {
+		return b.opts.metaUUID
+	}
+	return testUUID[:]
+}
+
+func (b *testImage) fs(opts ...Option) *FileSystem {
+	b.t.Helper()
+
+	img := b.build()
+	filesystem, err := NewFS(*io.NewSectionReader(bytes.NewReader(img), 0, int64(len(img))), nil, opts...)
+	if err != nil {
+		b.t.Fatalf("failed to open the test image: %s", err)
+	}
+	return filesystem
+}
+
+func (b *testImage) hasFtype() bool { return !b.opts.v4 || !b.opts.noFtype }
+
+func setTestCRC(buf []byte, off int) {
+	binary.LittleEndian.PutUint32(buf[off:], 0)
+	binary.LittleEndian.PutUint32(buf[off:], crc32.Checksum(buf, castagnoli))
+}
+
+func testFtype(mode uint16) uint8 {
+	switch mode & 0xf000 {
+	case 0x8000:
+		return XFS_DIR3_FT_REG_FILE
+	case 0x4000:
+		return XFS_DIR3_FT_DIR
+	case 0x2000:
+		return XFS_DIR3_FT_CHRDEV
+	case 0x6000:
+		return XFS_DIR3_FT_BLKDEV
+	case 0x1000:
+		return XFS_DIR3_FT_FIFO
+	case 0xc000:
+		return XFS_DIR3_FT_SOCK
+	case 0xa000:
+		return XFS_DIR3_FT_SYMLINK
+	}
+	return XFS_DIR3_FT_UNKNOWN
+}
+
+func (b *testImage) literal() int { return b.inodeSize - b.coreSize }
+
+func (b *testImage) writeInode(in *testInode) {
+	lit := b.literal()
+	var afork *testFork
+	forkoff := in.forkoff
+	if len(in.xattrs) > 0 {
+		afork = b.buildAttrFork(in)
+		if forkoff == 0 {
+			forkoff = (lit - (len(afork.content)+7)&^7) / 8
+		}
+	}
+	dsize := lit
+	if forkoff != 0 {
+		dsize = forkoff * 8
+	}
+
+	var dfork *testFork
+	var size uint64
+	switch in.mode & 0xf000 {
+	case 0x4000:
+		dfork, size = b.buildDir(in, dsize)
+	case 0x8000:
+		dfork = b.buildFile(in, dsize)
+		size = uint64(len(in.data))
+		if len(in.sparse) > 0 {
+			size = (in.sparse[len(in.sparse)-1] + 1) * uint64(b.blockSize)
+		}
+	case 0xa000:
+		dfork = b.buildSymlink(in, dsize)
+		size = uint64(len(in.target))
+	default:
+		c := make([]byte, 4)
+		binary.BigEndian.PutUint32(c, in.rdev)
+		dfork = &testFork{format: XFS_DINODE_FMT_DEV, content: c}
+	}
+	if len(dfork.content) > dsize {
+		b.t.Fatalf("data fork of inode %d is too big: %d > %d", in.ino, len(dfork.content), dsize)
+	}
+	if afork != nil && b.coreSize+forkoff*8+len(afork.content) > b.inodeSize {
+		b.t.Fatalf("attribute fork of inode %d is too big: %d", in.ino, len(afork.content))
+	}
+
+	off := b.inodeOffset(in.ino)
+	buf := b.img[off : off+b.inodeSize]
+	be := binary.BigEndian
+	be.PutUint16(buf[0:], XFS_DINODE_MAGIC)
+	be.PutUint16(buf[2:], in.mode)
+	buf[4] = 3
+	if b.opts.v4 {
+		buf[4] = 2
+	}
+	buf[5] = dfork.format
+	be.PutUint32(buf[16:], in.nlink)
+	ts := uint64(uint32(in.mtime.Unix()))<<32 | uint64(in.mtime.Nanosecond())
+	be.PutUint64(buf[32:], ts)
+	be.PutUint64(buf[40:], ts)
+	be.PutUint64(buf[48:], ts)
+	be.PutUint64(buf[56:], size)
+	be.PutUint32(buf[76:], uint32(dfork.nextents))
+	if afork != nil {
+		be.PutUint16(buf[80:], uint16(afork.nextents))
+		buf[82] = uint8(forkoff)
+		buf[83] = afork.format
+	} else {
+		buf[83] = XFS_DINODE_FMT_EXTENTS
+	}
+	be.PutUint32(buf[92:], 1)
+	be.PutUint32(buf[96:], 0xffffffff)
+	if !b.opts.v4 {
+		be.PutUint64(buf[104:], 1)
+		be.PutUint64(buf[144:], ts)
+		be.PutUint64(buf[152:], in.ino)
+		copy(buf[160:], b.uuid())
+	}
+	copy(buf[b.coreSize:], dfork.content)
+	if afork != nil {
+		copy(buf[b.coreSize+forkoff*8:], afork.content)
+	}
+	if !b.opts.v4 {
+		setTestCRC(buf, XFS_DINODE_CRC_OFF)
+	}
+}
+
+func (b *testImage) inodeOffset(ino uint64) int {
+	ag := ino >> (b.agblklog + b.inopblog)
+	agbno := (ino >> b.inopblog) & (1<<b.agblklog - 1)
+	o := ino & (1<<b.inopblog - 1)
+	return int((ag*testAGBlocks+agbno)*uint64(b.blockSize)) + int(o)*b.inodeSize
+}
+
+// packBmbtRec is the inverse of BmbtRec.Unpack.
+func packBmbtRec(r testRec) []byte {
+	out := make([]byte, 16)
+	binary.BigEndian.PutUint64(out[0:], r.off<<9|r.fsb>>43)
+	binary.BigEndian.PutUint64(out[8:], r.fsb<<21|r.len)
+	return out
+}
+
+// allocRegion allocates n blocks mapped at the logical block off.
+func (b *testImage) allocRegion(off, n uint64, fragment bool) []testRec {
+	var recs []testRec
+	if fragment {
+		for i := uint64(0); i < n; i++ {
+			recs = append(recs, testRec{off + i, b.allocData(1), 1})
+		}
+		return recs
+	}
+	return append(recs, testRec{off, b.allocData(int(n)), n})
+}
+
+// mapFork returns the fork mapping recs, in extents format if they fit in the fork and btree format if not.
+func (b *testImage) mapFork(in *testInode, recs []testRec, forkSize int) *testFork {
+	sort.Slice(recs, func(i, j int) bool { return recs[i].off < recs[j].off })
+	if len(recs)*16 <= forkSize {
+		var c []byte
+		for _, r := range recs {
+			c = append(c, packBmbtRec(r)...)
+		}
+		return &testFork{format: XFS_DINODE_FMT_EXTENTS, content: c, nextents: len(recs)}
+	}
+
+	hdr := 72
+	if b.opts.v4 {
+		hdr = 24
+	}
+	maxrecs := (b.blockSize - hdr) / 16
+	type child struct {
+		key uint64
+		fsb uint64
+	}
+	var children []child
+	var blocks []uint64
+	for i := 0; i < len(recs); i += maxrecs {
+		j := min(i+maxrecs, len(recs))
+		fsb := b.allocData(1)
+		blocks = append(blocks, fsb)
+		children = append(children, child{recs[i].off, fsb})
+		blk := b.block(fsb)
+		for k, r := range recs[i:j] {
+			copy(blk[hdr+k*16:], packBmbtRec(r))
+		}
+		b.btreeHdr(blk, 0, j-i, fsb, in.ino)
+	}
+	b.linkSiblings(blocks)
+
+	level := 1
+	nodeMaxrecs := (b.blockSize - hdr) / 16
+	rootMaxrecs := (forkSize - 4) / 16
+	for len(children) > rootMaxrecs {
+		var parents []child
+		var nodes []uint64
+		for i := 0; i < len(children); i += nodeMaxrecs {
+			j := min(i+nodeMaxrecs, len(children))
+			fsb := b.allocData(1)
+			nodes = append(nodes, fsb)
+			parents = append(parents, child{children[i].key, fsb})
+			blk := b.block(fsb)
+			for k, c := range children[i:j] {
+				binary.BigEndian.PutUint64(blk[hdr+k*8:], c.key)
+				binary.BigEndian.PutUint64(blk[hdr+nodeMaxrecs*8+k*8:], c.fsb)
+			}
+			b.btreeHdr(blk, level, j-i, fsb, in.ino)
+		}
+		b.linkSiblings(nodes)
+		children = parents
+		level++
+	}
+
+	c := make([]byte, forkSize)
+	binary.BigEndian.PutUint16(c[0:], uint16(level))
+	binary.BigEndian.PutUint16(c[2:], uint16(len(children)))
+	for k, n := range children {
+		binary.BigEndian.PutUint64(c[4+k*8:], n.key)
+		binary.BigEndian.PutUint64(c[4+rootMaxrecs*8+k*8:], n.fsb)
+	}
+	return &testFork{format: XFS_DINODE_FMT_BTREE, content: c, nextents: len(recs)}
+}
+
+func (b *testImage) btreeHdr(blk []byte, level, numrecs int, fsb, owner uint64) {
+	be := binary.BigEndian
+	if b.opts.v4 {
+		be.PutUint32(blk[0:], XFS_BMAP_MAGIC)
+	} else {
+		be.PutUint32(blk[0:], XFS_BMAP_CRC_MAGIC)
+	}
+	be.PutUint16(blk[4:], uint16(level))
+	be.PutUint16(blk[6:], uint16(numrecs))
+	be.PutUint64(blk[8:], ^uint64(0))
+	be.PutUint64(blk[16:], ^uint64(0))
+	if !b.opts.v4 {
+		be.PutUint64(blk[24:], b.daddr(fsb))
+		copy(blk[40:], b.uuid())
+		be.PutUint64(blk[56:], owner)
+	}
+}
+
+// linkSiblings links the btree blocks of a level and computes the checksums.
+func (b *testImage) linkSiblings(blocks []uint64) {
+	for i, fsb := range blocks {
+		blk := b.block(fsb)
+		if i > 0 {
+			binary.BigEndian.PutUint64(blk[8:], blocks[i-1])
+		}
+		if i < len(blocks)-1 {
+			binary.BigEndian.PutUint64(blk[16:], blocks[i+1])
+		}
+		if !b.opts.v4 {
+			setTestCRC(blk, XFS_BTREE_LBLOCK_CRC_OFF)
+		}
+	}
+}
+
+func (b *testImage) buildFile(in *testInode, dsize int) *testFork {
+	bs := uint64(b.blockSize)
+	n := (uint64(len(in.data)) + bs - 1) / bs
+	var recs []testRec
+	if n > 0 {
+		recs = b.allocRegion(0, n, in.fragment)
+	}
+	for _, r := range recs {
+		for i := uint64(0); i < r.len; i++ {
+			copy(b.block(r.fsb+i), in.data[(r.off+i)*bs:])
+		}
+	}
+	for _, logical := range in.sparse {
+		r := b.allocRegion(logical, 1, false)
+		binary.BigEndian.PutUint64(b.block(r[0].fsb), logical)
+		recs = append(recs, r...)
+	}
+	return b.mapFork(in, recs, dsize)
+}
+
+// buildSymlink stores the target in the data fork if it fits, or in remote blocks.
+// On v5 filesystems every extent starts with a xfs_dsymlink_hdr, and the checksum covers the whole extent.
+func (b *testImage) buildSymlink(in *testInode, dsize int) *testFork {
+	target := []byte(in.target)
+	if len(target) <= dsize {
+		return &testFork{format: XFS_DINODE_FMT_LOCAL, content: target}
+	}
+	hdr := 56
+	if b.opts.v4 {
+		hdr = 0
+	}
+	n := (len(target) + b.blockSize - hdr - 1) / (b.blockSize - hdr)
+	if !in.fragment {
+		// a single mapping has a single header
+		n = (len(target) + hdr + b.blockSize - 1) / b.blockSize
+	}
+	recs := b.allocRegion(0, uint64(n), in.fragment)
+	off := 0
+	for _, r := range recs {
+		o := b.fsbOffset(r.fsb)
+		buf := b.img[o : o+int(r.len)*b.blockSize]
+		chunk := target[off:]
+		if len(chunk) > len(buf)-hdr {
+			chunk = chunk[:len(buf)-hdr]
+		}
+		copy(buf[hdr:], chunk)
+		if !b.opts.v4 {
+			be := binary.BigEndian
+			be.PutUint32(buf[0:], XFS_SYMLINK_MAGIC)
+			be.PutUint32(buf[4:], uint32(off))
+			be.PutUint32(buf[8:], uint32(len(chunk)))
+			copy(buf[16:], b.uuid())
+			be.PutUint64(buf[32:], in.ino)
+			be.PutUint64(buf[40:], b.daddr(r.fsb))
+			be.PutUint64(buf[48:], 1)
+			setTestCRC(buf, XFS_ATTR3_RMT_CRC_OFF)
+		}
+		off += len(chunk)
+	}
+	return b.mapFork(in, recs, dsize)
+}
+
+func (b *testImage) dirBlkSize() int { return b.blockSize << b.opts.dirBlkLog }
+
+func (b *testImage) dataHdrSize() int {
+	if b.opts.v4 {
+		return 16
+	}
+	return 64
+}
+
+func (b *testImage) leafHdrSize() int {
+	if b.opts.v4 {
+		return 16
+	}
+	return 64
+}
+
+func (b *testImage) entSize(namelen int) int {
+	n := 8 + 1 + namelen + 2
+	if b.hasFtype() {
+		n++
+	}
+	return (n + 7) &^ 7
+}
+
+// testPlaced is a directory entry placed in a data block.
+type testPlaced struct {
+	hash uint32
+	// address is the byte offset of the entry in the data blocks >> 3
+	address uint32
+}
+
+// testDirBlock is a directory block at the logical block of the data fork.
+type testDirBlock struct {
+	logical uint64
+	buf     []byte
+}
+
+func (b *testImage) buildDir(in *testInode, dsize int) (*testFork, uint64) {
+	ents := append([]testDirent{{".", in}, {"..", in.parent}}, in.children...)
+	format := in.dirFormat
+	if format == "" {
+		if sf := b.shortform(in); len(sf) <= dsize {
+			return &testFork{format: XFS_DINODE_FMT_LOCAL, content: sf}, uint64(len(sf))
+		}
+		format = "block"
+	}
+	dbs := b.dirBlkSize()
+	if format == "block" {
+		used := b.dataHdrSize() + len(ents)*8 + 8
+		for _, e := range ents {
+			used += b.entSize(len(e.name))
+		}
+		if used > dbs {
+			format = "leaf"
+		}
+	}
+	fsbPerDb := uint64(1) << b.opts.dirBlkLog
+
+	var blocks []testDirBlock
+	newBlock := func(logical uint64) []byte {
+		buf := make([]byte, dbs)
+		blocks = append(blocks, testDirBlock{logical, buf})
+		return buf
+	}
+
+	var placed []testPlaced
+	var size uint64
+	if format == "block" {
+		buf := newBlock(0)
+		off := b.dataHdrSize()
+		for _, e := range ents {
+			placed = append(placed, b.putEntry(buf, 0, off, e))
+			off += b.entSize(len(e.name))
+		}
+		leafStart := dbs - 8 - len(ents)*8
+		b.putUnused(buf, off, leafStart-off)
+		sort.SliceStable(placed, func(i, j int) bool { return placed[i].hash < placed[j].hash })
+		for i, p := range placed {
+			binary.BigEndian.PutUint32(buf[leafStart+i*8:], p.hash)
+			binary.BigEndian.PutUint32(buf[leafStart+i*8+4:], p.address)
+		}
+		binary.BigEndian.PutUint32(buf[dbs-8:], uint32(len(ents)))
+		b.dataHdr(buf, XFS_DIR3_BLOCK_MAGIC, XFS_DIR2_BLOCK_MAGIC, off, leafStart-off)
+		size = uint64(dbs)
+	} else {
+		db := 0
+		buf := newBlock(0)
+		off := b.dataHdrSize()
+		var bests []int
+		for _, e := range ents {
+			es := b.entSize(len(e.name))
+			if off+es > dbs {
+				b.putUnused(buf, off, dbs-off)
+				b.dataHdr(buf, XFS_DIR3_DATA_MAGIC, XFS_DIR2_DATA_MAGIC, off, dbs-off)
+				bests = append(bests, dbs-off)
+				db++
+				buf = newBlock(uint64(db) * fsbPerDb)
+				off = b.dataHdrSize()
+			}
+			placed = append(placed, b.putEntry(buf, db, off, e))
+			off += es
+		}
+		b.putUnused(buf, off, dbs-off)
+		b.dataHdr(buf, XFS_DIR3_DATA_MAGIC, XFS_DIR2_DATA_MAGIC, off, dbs-off)
+		bests = append(bests, dbs-off)
+		size = uint64((db + 1) * dbs)
+		sort.SliceStable(placed, func(i, j int) bool { return placed[i].hash < placed[j].hash })
+
+		leafBlock := uint64(XFS_DIR2_LEAF_OFFSET) / uint64(b.blockSize)
+		leafHdr := b.leafHdrSize()
+		if format == "leaf" && leafHdr+len(placed)*8+len(bests)*2+4 > dbs {
+			format = "node"
+		}
+		if format == "leaf" {
+			lbuf := newBlock(leafBlock)
+			for i, p := range placed {
+				binary.BigEndian.PutUint32(lbuf[leafHdr+i*8:], p.hash)
+				binary.BigEndian.PutUint32(lbuf[leafHdr+i*8+4:], p.address)
+			}
+			binary.BigEndian.PutUint32(lbuf[dbs-4:], uint32(len(bests)))
+			for i, best := range bests {
+				binary.BigEndian.PutUint16(lbuf[dbs-4-2*len(bests)+2*i:], uint16(best))
+			}
+			b.leafHdr(lbuf, XFS_DIR3_LEAF1_MAGIC, XFS_DIR2_LEAF1_MAGIC, len(placed), 0, 0)
+		} else {
+			per := (dbs - leafHdr) / 8
+			var leaves []testDirBlock
+			var counts []int
+			var lastHash []uint32
+			for i := 0; i < len(placed); i += per {
+				j := min(i+per, len(placed))
+				lbuf := make([]byte, dbs)
+				for k, p := range placed[i:j] {
+					binary.BigEndian.PutUint32(lbuf[leafHdr+k*8:], p.hash)
+					binary.BigEndian.PutUint32(lbuf[leafHdr+k*8+4:], p.address)
+				}
+				leaves = append(leaves, testDirBlock{leafBlock + uint64(len(leaves)+1)*fsbPerDb, lbuf})
+				counts = append(counts, j-i)
+				lastHash = append(lastHash, placed[j-1].hash)
+			}
+			for i := range leaves {
+				var forw, back uint32
+				if i > 0 {
+					back = uint32(leaves[i-1].logical)
+				}
+				if i < len(leaves)-1 {
+					forw = uint32(leaves[i+1].logical)
+				}
+				b.leafHdr(leaves[i].buf, XFS_DIR3_LEAFN_MAGIC, XFS_DIR2_LEAFN_MAGIC, counts[i], forw, back)
+				blocks = append(blocks, leaves[i])
+			}
+			nbuf := newBlock(leafBlock)
+			if leafHdr+len(leaves)*8 > dbs {
+				b.t.Fatalf("too many leaves for a single level da node: %d", len(leaves))
+			}
+			for i := range leaves {
+				binary.BigEndian.PutUint32(nbuf[leafHdr+i*8:], lastHash[i])
+				binary.BigEndian.PutUint32(nbuf[leafHdr+i*8+4:], uint32(leaves[i].logical))
+			}
+			b.daNodeHdr(nbuf, len(leaves), 1)
+		}
+	}
+
+	var recs []testRec
+	for _, blk := range blocks {
+		rs := b.allocRegion(blk.logical, fsbPerDb, in.fragment)
+		recs = append(recs, rs...)
+		// The self describing header has the daddr of the first filesystem block of the directory block.
+		b.finishDaBlock(blk.buf, rs[0].fsb, in.ino)
+		for _, r := range rs {
+			for i := uint64(0); i < r.len; i++ {
+				copy(b.block(r.fsb+i), blk.buf[int(r.off+i-blk.logical)*b.blockSize:])
+			}
+		}
+	}
+	return b.mapFork(in, recs, dsize), size
+}
+
+func (b *testImage) putEntry(buf []byte, db, off int, e testDirent) testPlaced {
+	be := binary.BigEndian
+	be.PutUint64(buf[off:], e.ino.ino)
+	buf[off+8] = uint8(len(e.name))
+	copy(buf[off+9:], e.name)
+	es := b.entSize(len(e.name))
+	if b.hasFtype() {
+		buf[off+9+len(e.name)] = testFtype(e.ino.mode)
+	}
+	be.PutUint16(buf[off+es-2:], uint16(off))
+	address := (uint64(db)*uint64(b.dirBlkSize()) + uint64(off)) >> 3
+	return testPlaced{hash: DaHashname([]byte(e.name)), address: uint32(address)}
+}
+
+func (b *testImage) putUnused(buf []byte, off, length int) {
+	if length <= 0 {
+		return
+	}
+	be := binary.BigEndian
+	be.PutUint16(buf[off:], XFS_DIR2_DATA_FREE_TAG)
+	be.PutUint16(buf[off+2:], uint16(length))
+	be.PutUint16(buf[off+length-2:], uint16(off))
+}
+
+func (b *testImage) dataHdr(buf []byte, v5Magic, v4Magic uint32, freeOff, freeLen int) {
+	be := binary.BigEndian
+	bestfree := 48
+	if b.opts.v4 {
+		be.PutUint32(buf[0:], v4Magic)
+		bestfree = 4
+	} else {
+		be.PutUint32(buf[0:], v5Magic)
+	}
+	if freeLen > 0 {
+		be.PutUint16(buf[bestfree:], uint16(freeOff))
+		be.PutUint16(buf[bestfree+2:], uint16(freeLen))
+	}
+}
+
+func (b *testImage) leafHdr(buf []byte, v5Magic, v4Magic uint16, count int, forw, back uint32) {
+	be := binary.BigEndian
+	be.PutUint32(buf[0:], forw)
+	be.PutUint32(buf[4:], back)
+	if b.opts.v4 {
+		be.PutUint16(buf[8:], v4Magic)
+		be.PutUint16(buf[12:], uint16(count))
+		return
+	}
+	be.PutUint16(buf[8:], v5Magic)
+	be.PutUint16(buf[56:], uint16(count))
+}
+
+func (b *testImage) shortform(in *testInode) []byte {
+	i8 := in.parent.ino > 0xffffffff
+	for _, c := range in.children {
+		if c.ino.ino > 0xffffffff {
+			i8 = true
+		}
+	}
+	out := []byte{uint8(len(in.children)), 0}
+	inoSize := 4
+	if i8 {
+		out[1] = uint8(len(in.children))
+		inoSize = 8
+	}
+	out = appendTestIno(out, in.parent.ino, inoSize)
+	off := b.dataHdrSize() + b.entSize(1) + b.entSize(2)
+	for _, c := range in.children {
+		out = append(out, uint8(len(c.name)), uint8(off>>8), uint8(off))
+		out = append(out, c.name...)
+		if b.hasFtype() {
+			out = append(out, testFtype(c.ino.mode))
+		}
+		out = appendTestIno(out, c.ino.ino, inoSize)
+		off += b.entSize(len(c.name))
+	}
+	return out
+}
+
+func appendTestIno(out []byte, ino uint64, size int) []byte {
+	if size == 8 {
+		return binary.BigEndian.AppendUint64(out, ino)
+	}
+	return binary.BigEndian.AppendUint32(out, uint32(ino))
+}
+
+func (b *testImage) daNodeHdr(buf []byte, count, level int) {
+	be := binary.BigEndian
+	if b.opts.v4 {
+		be.PutUint16(buf[8:], XFS_DA_NODE_MAGIC)
+		be.PutUint16(buf[12:], uint16(count))
+		be.PutUint16(buf[14:], uint16(level))
+		return
+	}
+	be.PutUint16(buf[8:], XFS_DA3_NODE_MAGIC)
+	be.PutUint16(buf[56:], uint16(count))
+	be.PutUint16(buf[58:], uint16(level))
+}
+
+// finishDaBlock fills the self describing fields and the checksum of a directory or attribute block on v5.
+func (b *testImage) finishDaBlock(buf []byte, fsb uint64, owner uint64) {
+	if b.opts.v4 {
+		return
+	}
+	be := binary.BigEndian
+	switch be.Uint32(buf[0:]) {
+	case XFS_DIR3_BLOCK_MAGIC, XFS_DIR3_DATA_MAGIC:
+		be.PutUint64(buf[8:], b.daddr(fsb))
+		be.PutUint64(buf[16:], 1)
+		copy(buf[24:], b.uuid())
+		be.PutUint64(buf[40:], owner)
+		setTestCRC(buf, XFS_DIR3_DATA_CRC_OFF)
+		return
+	}
+	be.PutUint64(buf[16:], b.daddr(fsb))
+	be.PutUint64(buf[24:], 1)
+	copy(buf[32:], b.uuid())
+	be.PutUint64(buf[48:], owner)
+	setTestCRC(buf, XFS_DA3_NODE_CRC_OFF)
+}
+
+// buildAttrFork stores the attributes in shortform if they fit in the inode, or in leaf or node format.
+// The values larger than a quarter of the block are stored in remote blocks, every block has a xfs_attr3_rmt_hdr on v5.
+func (b *testImage) buildAttrFork(in *testInode) *testFork {
+	sf := []byte{0, 0, uint8(len(in.xattrs)), 0}
+	fits := true
+	for _, x := range in.xattrs {
+		if len(x.value) > 255 || len(x.name) > 255 {
+			fits = false
+		}
+		sf = append(sf, uint8(len(x.name)), uint8(len(x.value)), x.flags)
+		sf = append(sf, x.name...)
+		sf = append(sf, x.value...)
+	}
+	binary.BigEndian.PutUint16(sf[0:], uint16(len(sf)))
+	if fits && !in.attrNode && len(sf) <= b.literal()/2 {
+		return &testFork{format: XFS_DINODE_FMT_LOCAL, content: sf}
+	}
+
+	be := binary.BigEndian
+	bs := b.blockSize
+	hdr := 80
+	rmtHdr := 56
+	if b.opts.v4 {
+		hdr = 32
+		rmtHdr = 0
+	}
+	type entry struct {
+		hash     uint32
+		x        testXattr
+		remote   bool
+		valueblk uint32
+	}
+	var ents []entry
+	var recs []testRec
+	// The remote values are mapped after the leaf and node blocks.
+	nextBlk := uint64(64)
+	for _, x := range in.xattrs {
+		e := entry{hash: DaHashname([]byte(x.name)), x: x}
+		if len(x.value) > bs/4 {
+			e.remote = true
+			e.valueblk = uint32(nextBlk)
+			per := bs - rmtHdr
+			n := (len(x.value) + per - 1) / per
+			rs := b.allocRegion(nextBlk, uint64(n), false)
+			recs = append(recs, rs...)
+			off := 0
+			for i := uint64(0); i < rs[0].len; i++ {
+				blk := b.block(rs[0].fsb + i)
+				chunk := x.value[off:]
+				if len(chunk) > per {
+					chunk = chunk[:per]
+				}
+				copy(blk[rmtHdr:], chunk)
+				if !b.opts.v4 {
+					be.PutUint32(blk[0:], XFS_ATTR3_RMT_MAGIC)
+					be.PutUint32(blk[4:], uint32(off))
+					be.PutUint32(blk[8:], uint32(len(chunk)))
+					copy(blk[16:], b.uuid())
+					be.PutUint64(blk[32:], in.ino)
+					be.PutUint64(blk[40:], b.daddr(rs[0].fsb+i))
+					be.PutUint64(blk[48:], 1)
+					setTestCRC(blk, XFS_ATTR3_RMT_CRC_OFF)
+				}
+				off += len(chunk)
+			}
+			nextBlk += uint64(n)
+		}
+		ents = append(ents, e)
+	}
+	sort.SliceStable(ents, func(i, j int) bool { return ents[i].hash < ents[j].hash })
+	nameSize := func(e entry) int {
+		if e.remote {
+			return (9 + len(e.x.name) + 3) &^ 3
+		}
+		return (3 + len(e.x.name) + len(e.x.value) + 3) &^ 3
+	}
+
+	var leaves [][]entry
+	var cur []entry
+	used := hdr
+	for _, e := range ents {
+		need := 8 + nameSize(e)
+		if used+need > bs || (in.attrNode && len(cur) >= 2) {
+			leaves = append(leaves, cur)
+			cur = nil
+			used = hdr
+		}
+		cur = append(cur, e)
+		used += need
+	}
+	leaves = append(leaves, cur)
+	node := len(leaves) > 1 || in.attrNode
+	firstLeaf := uint64(0)
+	if node {
+		firstLeaf = 1
+	}
+	var lastHash []uint32
+	var leafBlks []uint64
+	for li, l := range leaves {
+		logical := firstLeaf + uint64(li)
+		rs := b.allocRegion(logical, 1, false)
+		recs = append(recs, rs...)
+		blk := b.block(rs[0].fsb)
+		top := bs
+		for i, e := range l {
+			top -= nameSize(e)
+			eo := hdr + i*8
+			be.PutUint32(blk[eo:], e.hash)
+			be.PutUint16(blk[eo+4:], uint16(top))
+			flags := e.x.flags
+			if !e.remote {
+				flags |= XFS_ATTR_LOCAL
+			}
+			blk[eo+6] = flags
+			if e.remote {
+				be.PutUint32(blk[top:], e.valueblk)
+				be.PutUint32(blk[top+4:], uint32(len(e.x.value)))
+				blk[top+8] = uint8(len(e.x.name))
+				copy(blk[top+9:], e.x.name)
+			} else {
+				be.PutUint16(blk[top:], uint16(len(e.x.value)))
+				blk[top+2] = uint8(len(e.x.name))
+				copy(blk[top+3:], e.x.name)
+				copy(blk[top+3+len(e.x.name):], e.x.value)
+			}
+		}
+		var forw, back uint32
+		if li > 0 {
+			back = uint32(logical - 1)
+		}
+		if li < len(leaves)-1 {
+			forw = uint32(logical + 1)
+		}
+		be.PutUint32(blk[0:], forw)
+		be.PutUint32(blk[4:], back)
+		countOff := 56
+		if b.opts.v4 {
+			be.PutUint16(blk[8:], XFS_ATTR_LEAF_MAGIC)
+			countOff = 12
+		} else {
+			be.PutUint16(blk[8:], XFS_ATTR3_LEAF_MAGIC)
+		}
+		be.PutUint16(blk[countOff:], uint16(len(l)))
+		be.PutUint16(blk[countOff+2:], uint16(bs-top))
+		be.PutUint16(blk[countOff+4:], uint16(top))
+		be.PutUint16(blk[countOff+8:], uint16(hdr+len(l)*8))
+		be.PutUint16(blk[countOff+10:], uint16(top-hdr-len(l)*8))
+		b.finishDaBlock(blk, rs[0].fsb, in.ino)
+		lastHash = append(lastHash, l[len(l)-1].hash)
+		leafBlks = append(leafBlks, logical)
+	}
+	if node {
+		rs := b.allocRegion(0, 1, false)
+		recs = append(recs, rs...)
+		blk := b.block(rs[0].fsb)
+		nodeHdr := b.leafHdrSize()
+		for i := range leafBlks {
+			be.PutUint32(blk[nodeHdr+i*8:], lastHash[i])
+			be.PutUint32(blk[nodeHdr+i*8+4:], uint32(leafBlks[i]))
+		}
+		b.daNodeHdr(blk, len(leafBlks), 1)
+		b.finishDaBlock(blk, rs[0].fsb, in.ino)
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].off < recs[j].off })
+	var c []byte
+	for _, r := range recs {
+		c = append(c, packBmbtRec(r)...)
+	}
+	return &testFork{format: XFS_DINODE_FMT_EXTENTS, content: c, nextents: len(recs)}
+}
+
+func (b *testImage) writeHeaders() {
+	be := binary.BigEndian
+	for ag := 0; ag < testAGCount; ag++ {
+		base := ag * testAGBlocks * b.blockSize
+		ss := b.sectSize
+
+		sb := b.img[base : base+ss]
+		be.PutUint32(sb[0:], XFS_SB_MAGIC)
+		be.PutUint32(sb[4:], uint32(b.blockSize))
+		be.PutUint64(sb[8:], uint64(testAGCount*testAGBlocks))
+		copy(sb[32:], testUUID[:])
+		be.PutUint64(sb[56:], b.root.ino)
+		be.PutUint32(sb[84:], uint32(testAGBlocks))
+		be.PutUint32(sb[88:], uint32(testAGCount))
+		// the versionnum of mkfs.xfs, v5 with nlink, align, logv2, extflg, dirv2 and morebits.
+		versionnum := uint16(0xb4a5)
+		if b.opts.v4 {
+			versionnum = versionnum&^XFS_SB_VERSION_NUMBITS | XFS_SB_VERSION_4
+		}
+		if b.opts.versionnum != 0 {
+			versionnum = b.opts.versionnum
+		}
+		be.PutUint16(sb[100:], versionnum)
+		be.PutUint16(sb[102:], uint16(ss))
+		be.PutUint16(sb[104:], uint16(b.inodeSize))
+		be.PutUint16(sb[106:], uint16(b.inopblock))
+		sb[120] = uint8(b.blocklog)
+		sb[121] = uint8(bits.TrailingZeros(uint(ss)))
+		sb[122] = uint8(bits.TrailingZeros(uint(b.inodeSize)))
+		sb[123] = uint8(b.inopblog)
+		sb[124] = uint8(b.agblklog)
+		be.PutUint64(sb[128:], uint64(len(b.inodes)))
+		sb[192] = uint8(b.opts.dirBlkLog)
+		features2 := uint32(XFS_SB_VERSION2_LAZYSBCOUNTBIT | XFS_SB_VERSION2_ATTR2BIT | XFS_SB_VERSION2_PROJID32BIT)
+		if !b.opts.v4 {
+			features2 |= XFS_SB_VERSION2_CRCBIT
+		}
+		if !b.opts.noFtype {
+			features2 |= XFS_SB_VERSION2_FTYPE
+		}
+		be.PutUint32(sb[200:], features2)
+		be.PutUint32(sb[204:], features2)
+		if !b.opts.v4 {
+			incompat := XFS_SB_FEAT_INCOMPAT_FTYPE | b.opts.incompat
+			if b.opts.metaUUID != nil {
+				incompat |= XFS_SB_FEAT_INCOMPAT_META_UUID
+				copy(sb[248:], b.opts.metaUUID)
+			}
+			be.PutUint32(sb[216:], incompat)
+			setTestCRC(sb, XFS_SB_CRC_OFF)
+		}
+
+		agf := b.img[base+ss : base+2*ss]
+		be.PutUint32(agf[0:], XFS_AGF_MAGIC)
+		be.PutUint32(agf[4:], 1)
+		be.PutUint32(agf[8:], uint32(ag))
+		be.PutUint32(agf[12:], uint32(testAGBlocks))
+		if !b.opts.v4 {
+			copy(agf[64:], b.uuid())
+			setTestCRC(agf, XFS_AGF_CRC_OFF)
+		}
+
+		agi := b.img[base+2*ss : base+3*ss]
+		be.PutUint32(agi[0:], XFS_AGI_MAGIC)
+		be.PutUint32(agi[4:], 1)
+		be.PutUint32(agi[8:], uint32(ag))
+		be.PutUint32(agi[12:], uint32(testAGBlocks))
+		for i := 0; i < 64; i++ {
+			be.PutUint32(agi[40+i*4:], 0xffffffff)
+		}
+		if !b.opts.v4 {
+			copy(agi[296:], b.uuid())
+			setTestCRC(agi, XFS_AGI_CRC_OFF)
+		}
+
+		agfl := b.img[base+3*ss : base+4*ss]
+		start := 0
+		if !b.opts.v4 {
+			be.PutUint32(agfl[0:], XFS_AGFL_MAGIC)
+			be.PutUint32(agfl[4:], uint32(ag))
+			copy(agfl[8:], b.uuid())
+			start = 36
+		}
+		for i := start; i+4 <= ss; i += 4 {
+			be.PutUint32(agfl[i:], 0xffffffff)
+		}
+		if !b.opts.v4 {
+			setTestCRC(agfl, XFS_AGFL_CRC_OFF)
+		}
+	}
+}
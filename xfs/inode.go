@@ -4,13 +4,14 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/hex"
+	"fmt"
 	"io"
+	"time"
 	"unsafe"
 
 	"golang.org/x/xerrors"
 
 	"github.com/masahiro331/go-xfs-filesystem/log"
-	"github.com/masahiro331/go-xfs-filesystem/xfs/utils"
 )
 
 var (
@@ -41,6 +42,9 @@ type Inode struct {
 
 	// S_IFLNK
 	symlinkString *SymlinkString
+
+	// raw attribute fork, nil if the inode has no attribute fork
+	attributeFork []byte
 }
 
 type RegularExtent struct {
@@ -53,7 +57,6 @@ type DirectoryExtents struct {
 
 type Btree struct {
 	bmbrBlock BmbrBlock
-	bmbtRecs  []BmbtRec
 }
 
 type DirectoryLocal struct {
@@ -102,6 +105,15 @@ type BtreeBlock struct {
 	Padding   int32
 }
 
+// BtreeLblock is the long format btree block header of v4 filesystem, BtreeBlock without the CRC fields.
+type BtreeLblock struct {
+	Magic      uint32
+	Level      uint16
+	Numrecs    uint16
+	BbLeftsib  int64
+	BbRightsib int64
+}
+
 // https://github.com/torvalds/linux/blob/d2b6f8a179194de0ffc4886ffc2c4358d86047b8/fs/xfs/libxfs/xfs_format.h#L1821
 type BmbtKey uint64
 
@@ -133,6 +145,41 @@ type Dir2LeafEntry struct {
 	Address uint32
 }
 
+// https://github.com/torvalds/linux/blob/5bfc75d92efd494db37f5c4c173d3639d4772966/fs/xfs/libxfs/xfs_da_format.h
+type Da3Blkinfo struct {
+	Forw  uint32
+	Back  uint32
+	Magic uint16
+	Pad   uint16
+	CRC   uint32
+	Blkno uint64
+	Lsn   uint64
+	UUID  [16]byte
+	Owner uint64
+}
+
+// Dir3LeafHdr is the header of LEAF1 and LEAFN blocks, followed by Count Dir2LeafEntry.
+type Dir3LeafHdr struct {
+	Info  Da3Blkinfo
+	Count uint16
+	Stale uint16
+	Pad   uint32
+}
+
+// Da3NodeHdr is the header of da-btree node blocks, followed by Count DaNodeEntry.
+type Da3NodeHdr struct {
+	Info  Da3Blkinfo
+	Count uint16
+	Level uint16
+	Pad   uint32
+}
+
+// DaNodeEntry points the child block which has hash values up to Hashval.
+type DaNodeEntry struct {
+	Hashval uint32
+	Before  uint32
+}
+
 // https://github.com/torvalds/linux/blob/5bfc75d92efd494db37f5c4c173d3639d4772966/fs/xfs/libxfs/xfs_da_format.h#L320-L324
 type Dir3DataHdr struct {
 	Dir3BlkHdr
@@ -188,12 +235,28 @@ type Dir2SfEntry struct {
 	Inumber32 uint32
 }
 
-type Device struct{}
+// Device is the data fork of XFS_DINODE_FMT_DEV inode, it has only xfs_dev_t.
+type Device struct {
+	Rdev uint32
+}
 
 type SymlinkString struct {
 	Name string
 }
 
+// DsymlinkHdr is the header of remote symlink blocks, v5 filesystem only.
+// https://github.com/torvalds/linux/blob/5bfc75d92efd494db37f5c4c173d3639d4772966/fs/xfs/libxfs/xfs_format.h
+type DsymlinkHdr struct {
+	Magic  uint32
+	Offset uint32
+	Bytes  uint32
+	CRC    uint32
+	UUID   [16]byte
+	Owner  uint64
+	Blkno  uint64
+	Lsn    uint64
+}
+
 type InodeCore struct {
 	Magic        uint16
 	Mode         uint16
@@ -239,9 +302,13 @@ type InobtRec struct {
 	Free      uint64
 }
 
-func (xfs *FileSystem) inodeFormatDevice(inode Inode) Inode {
-	inode.device = &Device{}
-	return inode
+func (xfs *FileSystem) inodeFormatDevice(r io.Reader, inode Inode) (Inode, error) {
+	var device Device
+	if err := binary.Read(r, binary.BigEndian, &device); err != nil {
+		return Inode{}, xerrors.Errorf("failed to read device number: %w", err)
+	}
+	inode.device = &device
+	return inode, nil
 }
 
 func (xfs *FileSystem) inodeFormatLocal(r io.Reader, inode Inode) (Inode, error) {
@@ -256,7 +323,7 @@ func (xfs *FileSystem) inodeFormatLocal(r io.Reader, inode Inode) (Inode, error)
 			isI8count = true
 		}
 		for i := 0; i < int(inode.directoryLocal.dir2SfHdr.Count); i++ {
-			entry, err := parseEntry(r, isI8count)
+			entry, err := parseEntry(r, isI8count, xfs.PrimaryAG.SuperBlock.HasFtype())
 			if err != nil {
 				return Inode{}, xerrors.Errorf("failed to parse entries[%d]: %w", i, err)
 			}
@@ -279,9 +346,9 @@ func (xfs *FileSystem) inodeFormatLocal(r io.Reader, inode Inode) (Inode, error)
 	return inode, nil
 }
 
-func (xfs *FileSystem) parseBmbtRecs(r io.Reader, count uint32) ([]BmbtRec, error) {
+func (xfs *FileSystem) parseBmbtRecs(r io.Reader, count uint64) ([]BmbtRec, error) {
 	var bmbtRecs []BmbtRec
-	for i := uint32(0); i < count; i++ {
+	for i := uint64(0); i < count; i++ {
 		var bmbtRec BmbtRec
 		if err := binary.Read(r, binary.BigEndian, &bmbtRec); err != nil {
 			return nil, xerrors.Errorf("read xfs_bmbt_irec error: %w", err)
@@ -295,18 +362,25 @@ func (xfs *FileSystem) inodeFormatExtents(r io.Reader, inode Inode) (Inode, erro
 	var err error
 	if inode.inodeCore.IsDir() {
 		inode.directoryExtents = &DirectoryExtents{}
-		inode.directoryExtents.bmbtRecs, err = xfs.parseBmbtRecs(r, inode.inodeCore.Nextents)
+		inode.directoryExtents.bmbtRecs, err = xfs.parseBmbtRecs(r, inode.inodeCore.DataExtents())
 		if err != nil {
 			return Inode{}, xerrors.Errorf("failed to parse directory bmbt recs: %w", err)
 		}
 	} else if inode.inodeCore.IsRegular() {
 		inode.regularExtent = &RegularExtent{}
-		inode.regularExtent.bmbtRecs, err = xfs.parseBmbtRecs(r, inode.inodeCore.Nextents)
+		inode.regularExtent.bmbtRecs, err = xfs.parseBmbtRecs(r, inode.inodeCore.DataExtents())
 		if err != nil {
 			return Inode{}, xerrors.Errorf("failed to parse regular bmbt recs: %w", err)
 		}
 	} else if inode.inodeCore.IsSymlink() {
-		log.Logger.Warn("not support XFS_DINODE_FMT_EXTENTS isSymlink")
+		bmbtRecs, err := xfs.parseBmbtRecs(r, inode.inodeCore.DataExtents())
+		if err != nil {
+			return Inode{}, xerrors.Errorf("failed to parse symlink bmbt recs: %w", err)
+		}
+		inode.symlinkString, err = xfs.parseRemoteSymlink(bmbtRecs, inode)
+		if err != nil {
+			return Inode{}, xerrors.Errorf("failed to parse remote symlink: %w", err)
+		}
 	} else {
 		log.Logger.Debugf("%+v\n", inode)
 		log.Logger.Debug("not support XFS_DINODE_FMT_EXTENTS")
@@ -315,140 +389,108 @@ func (xfs *FileSystem) inodeFormatExtents(r io.Reader, inode Inode) (Inode, erro
 	return inode, nil
 }
 
-func (xfs *FileSystem) walkBtree(level uint16, keys []BmbtKey, ptrs []BmbtPtr, inode Inode) (uint16, []BmbtKey, []BmbtPtr, error) {
-	if level == 1 {
-		return level, keys, ptrs, nil
-	}
-
-	var retKeys []BmbtKey
-	var retPtrs []BmbtPtr
-	for _, ptr := range ptrs {
-		nodeKeys, nodePtrs, err := xfs.parseBtreeNode(int64(ptr), inode)
+// parseRemoteSymlink reads a symlink target stored in separate blocks.
+// On v5 filesystem, each mapping starts with a DsymlinkHdr.
+// https://github.com/torvalds/linux/blob/5bfc75d92efd494db37f5c4c173d3639d4772966/fs/xfs/libxfs/xfs_symlink_remote.c
+func (xfs *FileSystem) parseRemoteSymlink(bmbtRecs []BmbtRec, inode Inode) (*SymlinkString, error) {
+	hasHeader := xfs.PrimaryAG.SuperBlock.HasCRC()
+	target := make([]byte, 0, inode.inodeCore.Size)
+	for _, rec := range bmbtRecs {
+		if uint64(len(target)) >= inode.inodeCore.Size {
+			break
+		}
+		p := rec.Unpack()
+		_, err := xfs.seekBlock(xfs.PrimaryAG.SuperBlock.BlockToPhysicalOffset(p.StartBlock))
 		if err != nil {
-			return 0, nil, nil, xerrors.Errorf("parse btree node (inode: %v, ptr: %d) error: %w", inode, ptr, err)
+			return nil, xerrors.Errorf("failed to seek block: %w", err)
 		}
-		retKeys = append(retKeys, nodeKeys...)
-		retPtrs = append(retPtrs, nodePtrs...)
-	}
-	level--
-	return xfs.walkBtree(level, retKeys, retPtrs, inode)
-}
-
-func (xfs *FileSystem) parseMultiLevelBtree(level uint16, keys []BmbtKey, ptrs []BmbtPtr, inode Inode) ([]BmbtRec, error) {
-	_, leafKeys, leafPtrs, err := xfs.walkBtree(level, keys, ptrs, inode)
-	if err != nil {
-		return nil, xerrors.Errorf("walk Btree error: %w", err)
-	}
-	return xfs.parseSingleLevelBtree(leafKeys, leafPtrs)
-}
-
-func (xfs *FileSystem) parseSingleLevelBtree(keys []BmbtKey, ptrs []BmbtPtr) ([]BmbtRec, error) {
-	var ret []BmbtRec
-	for _, ptr := range ptrs {
-		recs, err := xfs.parseBtreeLeafNode(int64(ptr))
+		buf, err := xfs.readBlock(uint32(p.BlockCount))
 		if err != nil {
-			return nil, xerrors.Errorf("parse btree leaf node(ptr: %d) error: %w", ptr, err)
+			return nil, xerrors.Errorf("failed to read block: %w", err)
 		}
 
-		ret = append(ret, recs...)
-	}
-	return ret, nil
-}
-
-func (xfs *FileSystem) parseBmbtKeyPtr(r io.Reader, inode Inode, numrecs uint16) ([]BmbtKey, []BmbtPtr, error) {
-	// parse bmbt keys
-	var keys []BmbtKey
-	for i := uint16(0); i < numrecs; i++ {
-		var key BmbtKey
-		if err := binary.Read(r, binary.BigEndian, &key); err != nil {
-			return nil, nil, xerrors.Errorf("failed to read regular bmbt key: %w", err)
+		data := buf
+		if hasHeader {
+			// the header and the checksum cover the whole mapping, not each block
+			what := fmt.Sprintf("symlink block %d of inode %d", p.StartBlock, inode.inodeCore.Ino)
+			daddr := xfs.PrimaryAG.SuperBlock.BlockToDaddr(p.StartBlock)
+			if err := xfs.verifyMetadata(what, buf, rmtFields, daddr, inode.inodeCore.Ino); err != nil {
+				return nil, err
+			}
+			var hdr DsymlinkHdr
+			if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &hdr); err != nil {
+				return nil, xerrors.Errorf("failed to read symlink header: %w", err)
+			}
+			if hdr.Magic != XFS_SYMLINK_MAGIC {
+				return nil, xerrors.Errorf("invalid symlink magic byte error: %08x", hdr.Magic)
+			}
+			if hdr.Owner != inode.inodeCore.Ino {
+				return nil, xerrors.Errorf("invalid symlink owner: actual(%d), expected(%d)", hdr.Owner, inode.inodeCore.Ino)
+			}
+			if int(hdr.Offset) != len(target) {
+				return nil, xerrors.Errorf("invalid symlink offset: actual(%d), expected(%d)", hdr.Offset, len(target))
+			}
+			data = buf[binary.Size(hdr):]
+			if int(hdr.Bytes) > len(data) {
+				return nil, xerrors.Errorf("invalid symlink bytes: %d", hdr.Bytes)
+			}
+			data = data[:hdr.Bytes]
 		}
-		keys = append(keys, key)
-	}
-
-	// Aformat is type of attribute fork
-	// 1: local
-	// 2: extents
-	// 3. btree
-	if inode.inodeCore.Aformat != 1 && inode.inodeCore.Forkoff != 0 {
-		return nil, nil, xerrors.Errorf("unsupported attribute fork error")
-	}
-
-	// read memory align
-	// TODO: check please this calculation
-	var tailKeysCount int
-	if inode.inodeCore.Forkoff == 0 {
-		// 20 is default value of key/pointer length
-		tailKeysCount = 20 - int(numrecs)
-	} else {
-		// (Forkoff - padding / 2(key/pointers)) - numrecs
-		tailKeysCount = int((inode.inodeCore.Forkoff-1)/2) - int(numrecs)
-	}
-	tailBuf := make([]byte, 8*tailKeysCount)
-	n, err := r.Read(tailBuf)
-	if err != nil {
-		return nil, nil, xerrors.Errorf("failed to read tail key buf: %w", err)
+		if remain := inode.inodeCore.Size - uint64(len(target)); uint64(len(data)) > remain {
+			data = data[:remain]
+		}
+		target = append(target, data...)
 	}
-	if n != len(tailBuf) {
-		return nil, nil, xerrors.Errorf("failed to read tail buf length actual (%d), expected (%d)", n, len(tailBuf))
+	if uint64(len(target)) != inode.inodeCore.Size {
+		return nil, xerrors.Errorf(ErrReadSizeFormat, len(target), inode.inodeCore.Size)
 	}
+	return &SymlinkString{Name: string(target)}, nil
+}
 
-	// parse bmbt ptr
-	var ptrs []BmbtPtr
-	for i := uint16(0); i < numrecs; i++ {
-		var ptr BmbtPtr
-		if err := binary.Read(r, binary.BigEndian, &ptr); err != nil {
-			return nil, nil, xerrors.Errorf("failed to read regular bmbt key: %w", err)
-		}
-		ptrs = append(ptrs, ptr)
+// parseBmbrBlock parses the bmbt root in the data or attribute fork, xfs_bmdr_block.
+// The keys and ptrs are placed as the fork has maxrecs entries, so the ptrs start after maxrecs keys,
+// and the fork size depends on the inode size and the attribute fork offset.
+// https://github.com/torvalds/linux/blob/5bfc75d92efd494db37f5c4c173d3639d4772966/fs/xfs/libxfs/xfs_bmap_btree.h
+func (xfs *FileSystem) parseBmbrBlock(r io.Reader, forkSize int) (*BmbrBlock, error) {
+	buf := make([]byte, forkSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, xerrors.Errorf("failed to read fork: %w", err)
 	}
-	return keys, ptrs, nil
-}
 
-func (xfs *FileSystem) parseBmbrBlock(r io.Reader, inode Inode) (*BmbrBlock, error) {
 	var bmbrBlock BmbrBlock
-	var err error
-	if err := binary.Read(r, binary.BigEndian, &bmbrBlock.Level); err != nil {
+	reader := bytes.NewReader(buf)
+	if err := binary.Read(reader, binary.BigEndian, &bmbrBlock.Level); err != nil {
 		return nil, xerrors.Errorf("binary read bmbr block level error: %w", err)
 	}
-	if err := binary.Read(r, binary.BigEndian, &bmbrBlock.Numrecs); err != nil {
+	if err := binary.Read(reader, binary.BigEndian, &bmbrBlock.Numrecs); err != nil {
 		return nil, xerrors.Errorf("binary read bmbr block numerecs error: %w", err)
 	}
 
-	bmbrBlock.keys, bmbrBlock.ptrs, err = xfs.parseBmbtKeyPtr(r, inode, bmbrBlock.Numrecs)
-	if err != nil {
-		return nil, xerrors.Errorf("parse bmbr key-ptr error: %w", err)
+	hdrSize := len(buf) - reader.Len()
+	maxrecs := BmbrMaxRecs(len(buf) - hdrSize)
+	if int(bmbrBlock.Numrecs) > maxrecs {
+		return nil, xerrors.Errorf("invalid bmbr numrecs: actual(%d), max(%d)", bmbrBlock.Numrecs, maxrecs)
+	}
+	bmbrBlock.keys = make([]BmbtKey, bmbrBlock.Numrecs)
+	if err := binary.Read(reader, binary.BigEndian, bmbrBlock.keys); err != nil {
+		return nil, xerrors.Errorf("failed to read bmbr keys: %w", err)
+	}
+	bmbrBlock.ptrs = make([]BmbtPtr, bmbrBlock.Numrecs)
+	ptrOffset := hdrSize + maxrecs*int(unsafe.Sizeof(BmbtKey(0)))
+	if err := binary.Read(bytes.NewReader(buf[ptrOffset:]), binary.BigEndian, bmbrBlock.ptrs); err != nil {
+		return nil, xerrors.Errorf("failed to read bmbr ptrs: %w", err)
 	}
 	return &bmbrBlock, nil
 }
 
 func (xfs *FileSystem) inodeFormatBtree(r io.Reader, inode Inode) (Inode, error) {
-	bmbrBlock, err := xfs.parseBmbrBlock(r, inode)
+	bmbrBlock, err := xfs.parseBmbrBlock(r, xfs.DataForkSize(inode.inodeCore.Forkoff))
 	if err != nil {
 		return Inode{}, xerrors.Errorf("parse bmbr block error: %w", err)
 	}
 	btree := &Btree{
 		bmbrBlock: *bmbrBlock,
 	}
-	if bmbrBlock.Level == 1 {
-		btree.bmbtRecs, err = xfs.parseSingleLevelBtree(
-			bmbrBlock.keys,
-			bmbrBlock.ptrs,
-		)
-		if err != nil {
-			return Inode{}, xerrors.Errorf("parse single level btree error: %w", err)
-		}
-	} else if bmbrBlock.Level > 1 {
-		btree.bmbtRecs, err = xfs.parseMultiLevelBtree(
-			bmbrBlock.Level,
-			bmbrBlock.keys,
-			bmbrBlock.ptrs,
-			inode,
-		)
-		if err != nil {
-			return Inode{}, xerrors.Errorf("parse multi level btree error: %w", err)
-		}
-	}
 	if inode.inodeCore.IsRegular() {
 		inode.regularBtree = btree
 	}
@@ -474,13 +516,9 @@ func (xfs *FileSystem) ParseInode(ino uint64) (*Inode, error) {
 		return nil, xerrors.Errorf("failed to seek inode: %w", err)
 	}
 
-	sectorReader, err := utils.NewSectorReader(int(xfs.PrimaryAG.SuperBlock.Inodesize))
-	if err != nil {
-		return nil, xerrors.Errorf("failed to create sector reader: %w", err)
-	}
-	buf, err := sectorReader.ReadSector(xfs.r)
-	if err != nil {
-		return nil, xerrors.Errorf("failed to read sector: %w", err)
+	buf := make([]byte, xfs.PrimaryAG.SuperBlock.Inodesize)
+	if _, err := io.ReadFull(xfs.r, buf); err != nil {
+		return nil, xerrors.Errorf("failed to read inode: %w", err)
 	}
 	r := bytes.NewReader(buf)
 
@@ -492,13 +530,38 @@ func (xfs *FileSystem) ParseInode(ino uint64) (*Inode, error) {
 		return nil, xerrors.Errorf("invalid magic byte error")
 	}
 
-	if !inode.inodeCore.isSupported() {
+	if !inode.inodeCore.isSupported(xfs.PrimaryAG.SuperBlock) {
 		return nil, xerrors.Errorf("not support inode version %d", inode.inodeCore.Version)
 	}
+	if err := xfs.verifyMetadata(fmt.Sprintf("inode %d", ino), buf, dinodeFields, 0, ino); err != nil {
+		return nil, err
+	}
+	dinodeSize := xfs.PrimaryAG.SuperBlock.DinodeSize()
+	if inode.inodeCore.Version < 3 {
+		// The v3 fields are the literal area of v1 and v2 inodes, they are read as zero.
+		core := make([]byte, INODEV3_SIZE)
+		copy(core, buf[:dinodeSize])
+		inode.inodeCore = InodeCore{}
+		if err := binary.Read(bytes.NewReader(core), binary.BigEndian, &inode.inodeCore); err != nil {
+			return nil, xerrors.Errorf("failed to read InodeCore: %w", err)
+		}
+		// v1 and v2 inodes don't record their own inode number.
+		inode.inodeCore.Ino = ino
+	}
+
+	// The data fork is the literal area up to the attribute fork, its size depends on the inode size.
+	dataForkSize := xfs.DataForkSize(inode.inodeCore.Forkoff)
+	if dinodeSize+dataForkSize > len(buf) {
+		return nil, xerrors.Errorf("invalid attribute fork offset: %d", inode.inodeCore.Forkoff)
+	}
+	r = bytes.NewReader(buf[dinodeSize : dinodeSize+dataForkSize])
 
 	switch inode.inodeCore.Format {
 	case XFS_DINODE_FMT_DEV:
-		inode = xfs.inodeFormatDevice(inode)
+		inode, err = xfs.inodeFormatDevice(r, inode)
+		if err != nil {
+			return nil, xerrors.Errorf("parse inode format device: %w", err)
+		}
 	case XFS_DINODE_FMT_LOCAL:
 		inode, err = xfs.inodeFormatLocal(r, inode)
 		if err != nil {
@@ -525,16 +588,37 @@ func (xfs *FileSystem) ParseInode(ino uint64) (*Inode, error) {
 		log.Logger.Warnf("not support inode format(%d)", inode.inodeCore.Format)
 	}
 
-	// TODO: support extend attribute fork , see. Chapter 19 Extended Attributes
-	// if inode.inodeCore.Forkoff != 0 {
-	// 	panic("has extend attribute fork")
-	// }
+	// The attribute fork is parsed on demand, see attr.go
+	if inode.inodeCore.Forkoff != 0 {
+		attrOffset := int(inode.AttributeOffset())
+		if attrOffset >= len(buf) {
+			return nil, xerrors.Errorf("invalid attribute fork offset: %d", inode.inodeCore.Forkoff)
+		}
+		inode.attributeFork = append([]byte(nil), buf[attrOffset:]...)
+	}
 
 	xfs.cache.Add(inodeCacheKey(ino), inode)
 	return &inode, nil
 }
 
 func (xfs *FileSystem) parseBtreeBlock(r io.Reader) (*BtreeBlock, error) {
+	if !xfs.PrimaryAG.SuperBlock.HasCRC() {
+		var lblock BtreeLblock
+		if err := binary.Read(r, binary.BigEndian, &lblock); err != nil {
+			return nil, xerrors.Errorf("failed to read b+tree block: %w", err)
+		}
+		if lblock.Magic != XFS_BMAP_MAGIC {
+			return nil, xerrors.Errorf("unsupported block header: (%d), expected BMAP_MAGIC", lblock.Magic)
+		}
+		return &BtreeBlock{
+			Magic:      lblock.Magic,
+			Level:      lblock.Level,
+			Numrecs:    lblock.Numrecs,
+			BbLeftsib:  lblock.BbLeftsib,
+			BbRightsib: lblock.BbRightsib,
+		}, nil
+	}
+
 	btreeBlock := &BtreeBlock{}
 	if err := binary.Read(r, binary.BigEndian, btreeBlock); err != nil {
 		return nil, xerrors.Errorf("failed to read b+tree block: %w", err)
@@ -545,60 +629,12 @@ func (xfs *FileSystem) parseBtreeBlock(r io.Reader) (*BtreeBlock, error) {
 	return btreeBlock, nil
 }
 
-func (xfs *FileSystem) parseBtreeNode(blockNumber int64, inode Inode) ([]BmbtKey, []BmbtPtr, error) {
-	physicalBlockOffset := xfs.PrimaryAG.SuperBlock.BlockToPhysicalOffset(uint64(blockNumber))
-	_, err := xfs.seekBlock(physicalBlockOffset)
-	if err != nil {
-		return nil, nil, xerrors.Errorf("failed to seek block: %w", err)
-	}
-	b, err := xfs.readBlock(1)
-	if err != nil {
-		return nil, nil, xerrors.Errorf("failed to read block: %w", err)
-	}
-
-	r := bytes.NewReader(b)
-	btreeBlock, err := xfs.parseBtreeBlock(r)
-	if err != nil {
-		return nil, nil, xerrors.Errorf("parse btree node (offset: %d) error: %w", blockNumber, err)
+// btreeBlockSize returns the size of the bmbt block header, v4 filesystem has no CRC fields.
+func (xfs *FileSystem) btreeBlockSize() int {
+	if !xfs.PrimaryAG.SuperBlock.HasCRC() {
+		return binary.Size(BtreeLblock{})
 	}
-
-	keys, ptrs, err := xfs.parseBmbtKeyPtr(r, inode, btreeBlock.Numrecs)
-	if err != nil {
-		return nil, nil, xerrors.Errorf("parse bmbr key-ptr error: %w", err)
-	}
-	return keys, ptrs, nil
-}
-
-func (xfs *FileSystem) parseBtreeLeafNode(blockNumber int64) ([]BmbtRec, error) {
-	physicalBlockOffset := xfs.PrimaryAG.SuperBlock.BlockToPhysicalOffset(uint64(blockNumber))
-	_, err := xfs.seekBlock(physicalBlockOffset)
-	if err != nil {
-		return nil, xerrors.Errorf("failed to seek block: %w", err)
-	}
-	b, err := xfs.readBlock(1)
-	if err != nil {
-		return nil, xerrors.Errorf("failed to read block: %w", err)
-	}
-
-	r := bytes.NewReader(b)
-	btreeBlock, err := xfs.parseBtreeBlock(r)
-	if err != nil {
-		return nil, xerrors.Errorf("parse btree node (offset: %d) error: %w", blockNumber*int64(xfs.PrimaryAG.SuperBlock.BlockSize), err)
-	}
-
-	if btreeBlock.Level > 1 {
-		return nil, xerrors.Errorf("unsupported deep b+tree level: %d", btreeBlock.Level)
-	}
-
-	recs := []BmbtRec{}
-	for i := uint16(0); i < btreeBlock.Numrecs; i++ {
-		var bmbtRec BmbtRec
-		if err := binary.Read(r, binary.BigEndian, &bmbtRec); err != nil {
-			return nil, xerrors.Errorf("failed to read extents xfs_bmbt_irec: %w", err)
-		}
-		recs = append(recs, bmbtRec)
-	}
-	return recs, nil
+	return binary.Size(BtreeBlock{})
 }
 
 // https://github.com/torvalds/linux/blob/d2b6f8a179194de0ffc4886ffc2c4358d86047b8/fs/xfs/libxfs/xfs_bmap_btree.c#L316
@@ -611,11 +647,15 @@ func (xfs *FileSystem) DataForkSize(forkoff uint8) int {
 	if forkoff > 0 {
 		return int(forkoff) << 3
 	}
-	return int(xfs.PrimaryAG.SuperBlock.Inodesize) - 176 // v3 InodeCore size
+	return int(xfs.PrimaryAG.SuperBlock.Inodesize) - xfs.PrimaryAG.SuperBlock.DinodeSize()
 }
 
 func (i *Inode) AttributeOffset() uint32 {
-	return uint32(i.inodeCore.Forkoff)*8 + INODEV3_SIZE
+	dinodeSize := uint32(INODEV3_SIZE)
+	if i.inodeCore.Version < 3 {
+		dinodeSize = INODEV2_SIZE
+	}
+	return uint32(i.inodeCore.Forkoff)*8 + dinodeSize
 }
 
 // Parse XDB3block, XDB3 block is single block architecture
@@ -698,15 +738,19 @@ func (xfs *FileSystem) parseDir2DataEntry(r io.Reader) ([]Dir2DataEntry, error)
 		}
 		entry.EntryName = string(nameBuf)
 
-		// Parse FileType
-		if err := binary.Read(r, binary.BigEndian, &entry.Filetype); err != nil {
-			return nil, xerrors.Errorf("failed to read file type: %w", err)
+		// Parse FileType, it exists only with the ftype feature
+		var filetypeSize int
+		if xfs.PrimaryAG.SuperBlock.HasFtype() {
+			if err := binary.Read(r, binary.BigEndian, &entry.Filetype); err != nil {
+				return nil, xerrors.Errorf("failed to read file type: %w", err)
+			}
+			filetypeSize = int(unsafe.Sizeof(entry.Filetype))
 		}
 
 		// Read Alignment, Dir2DataEntry is 8byte alignment
 		align := (int(unsafe.Sizeof(entry.Inumber)) +
 			int(unsafe.Sizeof(entry.Namelen)) +
-			int(unsafe.Sizeof(entry.Filetype)) +
+			filetypeSize +
 			int(unsafe.Sizeof(entry.Tag)) +
 			int(entry.Namelen)) % 8
 		if align != 0 {
@@ -728,76 +772,7 @@ func (xfs *FileSystem) parseDir2DataEntry(r io.Reader) ([]Dir2DataEntry, error)
 	}
 }
 
-func (xfs *FileSystem) parseDir2Block(bmbtIrec BmbtIrec) ([]Dir2DataEntry, error) {
-	block := Dir2Block{}
-	/*
-		Skip Leaf and Free node.
-		The "leaf" block has a special offset defined by XFS_DIR2_LEAF_OFFSET. Currently, this is 32GB and in the extent view,
-		a block offset of 32GB / sb_blocksize. On a 4KB block filesystem, this is 0x800000 (8388608 decimal).
-	*/
-	if int64(bmbtIrec.StartOff)*int64(xfs.PrimaryAG.SuperBlock.BlockSize) >= int64(XFS_DIR2_LEAF_OFFSET) {
-		return nil, nil
-	}
-
-	var buf []byte
-	for blockOffset := bmbtIrec.StartBlock; blockOffset < bmbtIrec.StartBlock+bmbtIrec.BlockCount; blockOffset++ {
-		physicalBlockOffset := xfs.PrimaryAG.SuperBlock.BlockToPhysicalOffset(blockOffset)
-		_, err := xfs.seekBlock(physicalBlockOffset)
-		if err != nil {
-			return nil, xerrors.Errorf("failed to seek block: %w", err)
-		}
-		blockData, err := utils.ReadBlock(xfs.r)
-		if err != nil {
-			return nil, xerrors.Errorf("failed to read block: %w", err)
-		}
-		buf = append(buf, blockData...)
-
-		// if the next block is not a leader, it is a continuation of the previous block
-		if blockOffset != bmbtIrec.StartBlock+bmbtIrec.BlockCount-1 && // not last block
-			!xfs.nextBlockIsLeader(blockOffset) { // not leader
-			continue
-		}
-
-		// if the next block is a leader, it is the last block of the directory
-		magicBytes := binary.BigEndian.Uint32(buf[:4])
-		reader := bytes.NewReader(buf)
-		if err := binary.Read(reader, binary.BigEndian, &block.Header); err != nil {
-			return nil, xerrors.Errorf("failed to parse dir3 data header error: %w", err)
-		}
-		switch magicBytes {
-		case XFS_DIR3_DATA_MAGIC:
-			entries, err := xfs.parseXDD3Block(reader)
-			if err != nil {
-				return nil, xerrors.Errorf("failed to parse XDD3 block: %w", err)
-			}
-			block.Entries = append(block.Entries, entries...)
-		case XFS_DIR3_BLOCK_MAGIC:
-			entries, err := xfs.parseXDB3Block(reader)
-			if err != nil {
-				return nil, xerrors.Errorf("failed to parse XDB3 block: %w", err)
-			}
-			block.Entries = append(block.Entries, entries...)
-		default:
-			return nil, xerrors.Errorf("unknown magic bytes: %x", magicBytes)
-		}
-
-		// reset buf
-		buf = []byte{}
-	}
-
-	return block.Entries, nil
-}
-
-func (xfs *FileSystem) nextBlockIsLeader(blockOffset uint64) bool {
-	physicalBlockOffset := xfs.PrimaryAG.SuperBlock.BlockToPhysicalOffset(blockOffset + 1)
-	xfs.seekBlock(physicalBlockOffset)
-	blockData, _ := utils.ReadBlock(xfs.r)
-
-	magic := binary.BigEndian.Uint32(blockData[:4])
-	return magic == XFS_DIR3_DATA_MAGIC || magic == XFS_DIR3_BLOCK_MAGIC
-}
-
-func parseEntry(r io.Reader, i8count bool) (*Dir2SfEntry, error) {
+func parseEntry(r io.Reader, i8count bool, ftype bool) (*Dir2SfEntry, error) {
 	var entry Dir2SfEntry
 	if err := binary.Read(r, binary.BigEndian, &entry.Namelen); err != nil {
 		return nil, err
@@ -815,8 +790,10 @@ func parseEntry(r io.Reader, i8count bool) (*Dir2SfEntry, error) {
 		return nil, xerrors.Errorf("read name error: %s", string(buf))
 	}
 	entry.EntryName = string(buf)
-	if err := binary.Read(r, binary.BigEndian, &entry.Filetype); err != nil {
-		return nil, err
+	if ftype {
+		if err := binary.Read(r, binary.BigEndian, &entry.Filetype); err != nil {
+			return nil, err
+		}
 	}
 
 	if i8count {
@@ -833,6 +810,94 @@ func parseEntry(r io.Reader, i8count bool) (*Dir2SfEntry, error) {
 	return &entry, nil
 }
 
+func (i *Inode) symlinkTarget() (string, error) {
+	if i.symlinkString == nil {
+		return "", xerrors.Errorf("unsupported symlink inode format: %d", i.inodeCore.Format)
+	}
+	return i.symlinkString.Name, nil
+}
+
+// Major returns the major number of the sysv encoded device number.
+func (d Device) Major() uint32 {
+	return (d.Rdev >> 18) & 0x3fff
+}
+
+// Minor returns the minor number of the sysv encoded device number.
+func (d Device) Minor() uint32 {
+	return d.Rdev & 0x3ffff
+}
+
+// LinkCount returns the number of hard links, v1 inode has it in di_onlink.
+func (ic InodeCore) LinkCount() uint32 {
+	if ic.Version == 1 {
+		return uint32(ic.OnLink)
+	}
+	return ic.NLink
+}
+
+// DataExtents returns the number of the data fork extents.
+// nrext64 inodes have the 64 bit counter di_big_nextents in Padding after di_projid_hi and di_flushiter.
+func (ic InodeCore) DataExtents() uint64 {
+	if ic.Version >= 3 && ic.Flags2&XFS_DIFLAG2_NREXT64 != 0 {
+		// shifting out di_projid_hi
+		return binary.BigEndian.Uint64(ic.Padding[:])<<16 | uint64(ic.Flushiter)
+	}
+	return uint64(ic.Nextents)
+}
+
+// AttrExtents returns the number of the attribute fork extents, nrext64 inodes have it in di_nextents.
+func (ic InodeCore) AttrExtents() uint64 {
+	if ic.Version >= 3 && ic.Flags2&XFS_DIFLAG2_NREXT64 != 0 {
+		return uint64(ic.Nextents)
+	}
+	return uint64(ic.Anextents)
+}
+
+// ProjectID returns the project ID, the high 16 bits are stored in di_projid_hi (the head of Padding).
+func (ic InodeCore) ProjectID() uint32 {
+	return uint32(binary.BigEndian.Uint16(ic.Padding[:2]))<<16 | uint32(ic.ProjId)
+}
+
+// AccessTime returns di_atime.
+func (ic InodeCore) AccessTime() time.Time {
+	return ic.decodeTimestamp(ic.Atime)
+}
+
+// ModifyTime returns di_mtime.
+func (ic InodeCore) ModifyTime() time.Time {
+	return ic.decodeTimestamp(ic.Mtime)
+}
+
+// ChangeTime returns di_ctime.
+func (ic InodeCore) ChangeTime() time.Time {
+	return ic.decodeTimestamp(ic.Ctime)
+}
+
+// CreateTime returns di_crtime, v3 inode only. It returns zero time for older inodes.
+func (ic InodeCore) CreateTime() time.Time {
+	if ic.Version < 3 {
+		return time.Time{}
+	}
+	return ic.decodeTimestamp(ic.Crtime)
+}
+
+// HasBigTime reports whether the timestamps of the inode are bigtime format.
+func (ic InodeCore) HasBigTime() bool {
+	return ic.Version >= 3 && ic.Flags2&XFS_DIFLAG2_BIGTIME != 0
+}
+
+// decodeTimestamp converts xfs_timestamp_t.
+// Legacy timestamps are signed 32-bit seconds and 32-bit nanoseconds,
+// bigtime timestamps are 64-bit nanoseconds since XFS_BIGTIME_EPOCH_OFFSET seconds before the Unix epoch.
+// https://github.com/torvalds/linux/blob/5bfc75d92efd494db37f5c4c173d3639d4772966/fs/xfs/libxfs/xfs_inode_buf.c
+func (ic InodeCore) decodeTimestamp(ts uint64) time.Time {
+	if ic.HasBigTime() {
+		sec := int64(ts/uint64(time.Second)) - XFS_BIGTIME_EPOCH_OFFSET
+		return time.Unix(sec, int64(ts%uint64(time.Second)))
+	}
+	return time.Unix(int64(int32(ts>>32)), int64(uint32(ts)))
+}
+
 func (ic InodeCore) IsDir() bool {
 	return ic.Mode&0xF000 == 0x4000
 }
@@ -849,8 +914,12 @@ func (ic InodeCore) IsSymlink() bool {
 	return ic.Mode&0xF000 == 0xA000
 }
 
-func (ic InodeCore) isSupported() bool {
-	return ic.Version == uint8(InodeSupportVersion)
+// isSupported reports whether the inode version is valid on the filesystem, v5 filesystem has only v3 inodes.
+func (ic InodeCore) isSupported(sb SuperBlock) bool {
+	if sb.HasCRC() {
+		return ic.Version == uint8(InodeSupportVersion)
+	}
+	return ic.Version == 1 || ic.Version == 2
 }
 
 // https://github.com/torvalds/linux/blob/d2b6f8a179194de0ffc4886ffc2c4358d86047b8/fs/xfs/libxfs/xfs_bmap_btree.c#L60
@@ -859,9 +928,15 @@ func (b BmbtRec) Unpack() BmbtIrec {
 		StartOff:   (b.L0 & Mask64Lo(64-BMBT_EXNTFLAG_BITLEN)) >> 9,
 		StartBlock: ((b.L0 & Mask64Lo(9)) << 43) | (b.L1 >> 21),
 		BlockCount: b.L1 & Mask64Lo(21),
+		State:      uint8(b.L0 >> (64 - BMBT_EXNTFLAG_BITLEN)),
 	}
 }
 
+// Unwritten reports whether the extent is preallocated but not written, it must be read as zeros.
+func (b BmbtIrec) Unwritten() bool {
+	return b.State == XFS_EXT_UNWRITTEN
+}
+
 func Mask64Lo(n int64) uint64 {
 	return (1 << n) - 1
 }
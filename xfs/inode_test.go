@@ -1,11 +1,14 @@
 package xfs
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseInode(t *testing.T) {
@@ -104,3 +107,293 @@ func TestParseInode(t *testing.T) {
 		})
 	}
 }
+
+func TestInodeCore_ModifyTime(t *testing.T) {
+	testCases := []struct {
+		name      string
+		inodeCore InodeCore
+		expected  time.Time
+	}{
+		{
+			name:      "legacy timestamp with nanoseconds",
+			inodeCore: InodeCore{Version: 3, Mtime: 1700000000<<32 | 123456789},
+			expected:  time.Unix(1700000000, 123456789),
+		},
+		{
+			name:      "legacy timestamp before 1970",
+			inodeCore: InodeCore{Version: 3, Mtime: uint64(0xffffffff)<<32 | 5},
+			expected:  time.Unix(-1, 5),
+		},
+		{
+			name:      "legacy timestamp of v2 inode",
+			inodeCore: InodeCore{Version: 2, Flags2: XFS_DIFLAG2_BIGTIME, Mtime: 1<<32 | 1},
+			expected:  time.Unix(1, 1),
+		},
+		{
+			name:      "bigtime epoch",
+			inodeCore: InodeCore{Version: 3, Flags2: XFS_DIFLAG2_BIGTIME, Mtime: 0},
+			expected:  time.Unix(-1<<31, 0),
+		},
+		{
+			name:      "bigtime after 2038",
+			inodeCore: InodeCore{Version: 3, Flags2: XFS_DIFLAG2_BIGTIME, Mtime: (4102444800+1<<31)*1000000000 + 500000000},
+			expected:  time.Date(2100, 1, 1, 0, 0, 0, 500000000, time.UTC),
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.inodeCore.ModifyTime()
+			if !got.Equal(tt.expected) {
+				t.Fatalf("name: %s, expected %s, actual %s", tt.name, tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDevice_MajorMinor(t *testing.T) {
+	// makedev(136, 3) encoded by sysv_encode_dev
+	device := Device{Rdev: 136<<18 | 3}
+	if device.Major() != 136 {
+		t.Fatalf("expected major 136, actual %d", device.Major())
+	}
+	if device.Minor() != 3 {
+		t.Fatalf("expected minor 3, actual %d", device.Minor())
+	}
+}
+
+func TestInodeCore_ProjectID(t *testing.T) {
+	inodeCore := InodeCore{ProjId: 0x2345, Padding: [8]byte{0x00, 0x01}}
+	if inodeCore.ProjectID() != 0x12345 {
+		t.Fatalf("expected project id 0x12345, actual %#x", inodeCore.ProjectID())
+	}
+}
+
+func TestBmbtRec_Unpack(t *testing.T) {
+	testCases := []struct {
+		name     string
+		rec      BmbtRec
+		expected BmbtIrec
+	}{
+		{
+			name: "normal extent",
+			rec: BmbtRec{
+				L0: 5<<9 | 0x1ff,
+				L1: 0x7ff<<21 | 7,
+			},
+			expected: BmbtIrec{StartOff: 5, StartBlock: 0x1ff<<43 | 0x7ff, BlockCount: 7, State: XFS_EXT_NORM},
+		},
+		{
+			name: "unwritten extent",
+			rec: BmbtRec{
+				L0: 1<<63 | 5<<9,
+				L1: 0x1234<<21 | 7,
+			},
+			expected: BmbtIrec{StartOff: 5, StartBlock: 0x1234, BlockCount: 7, State: XFS_EXT_UNWRITTEN},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.rec.Unpack()
+			if got != tt.expected {
+				t.Fatalf("name: %s, expected %+v, actual %+v", tt.name, tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseBmbrBlock(t *testing.T) {
+	testCases := []struct {
+		name      string
+		inodeSize uint16
+		forkoff   uint8
+	}{
+		{
+			name:      "512 bytes inode without attribute fork",
+			inodeSize: 512,
+		},
+		{
+			name:      "256 bytes inode without attribute fork",
+			inodeSize: 256,
+		},
+		{
+			name:      "local attribute fork",
+			inodeSize: 512,
+			forkoff:   31,
+		},
+		{
+			name:      "extents attribute fork",
+			inodeSize: 512,
+			forkoff:   36,
+		},
+		{
+			name:      "btree attribute fork",
+			inodeSize: 1024,
+			forkoff:   100,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			fileSystem := &FileSystem{}
+			fileSystem.PrimaryAG.SuperBlock.Inodesize = tt.inodeSize
+
+			// level 1, 2 records, ptrs are placed after maxrecs keys
+			buf := make([]byte, fileSystem.DataForkSize(tt.forkoff))
+			maxrecs := (len(buf) - 4) / 16
+			binary.BigEndian.PutUint16(buf[0:], 1)
+			binary.BigEndian.PutUint16(buf[2:], 2)
+			binary.BigEndian.PutUint64(buf[4:], 0)
+			binary.BigEndian.PutUint64(buf[12:], 100)
+			binary.BigEndian.PutUint64(buf[4+maxrecs*8:], 1234)
+			binary.BigEndian.PutUint64(buf[4+maxrecs*8+8:], 5678)
+
+			bmbrBlock, err := fileSystem.parseBmbrBlock(bytes.NewReader(buf), len(buf))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bmbrBlock.Level != 1 || bmbrBlock.Numrecs != 2 {
+				t.Fatalf("name: %s, expected level 1 and 2 records, actual %d, %d", tt.name, bmbrBlock.Level, bmbrBlock.Numrecs)
+			}
+			if bmbrBlock.keys[1] != 100 {
+				t.Fatalf("name: %s, expected key 100, actual %d", tt.name, bmbrBlock.keys[1])
+			}
+			if bmbrBlock.ptrs[0] != 1234 || bmbrBlock.ptrs[1] != 5678 {
+				t.Fatalf("name: %s, expected ptrs [1234 5678], actual %v", tt.name, bmbrBlock.ptrs)
+			}
+		})
+	}
+}
+
+func TestInodeCore_DataExtents(t *testing.T) {
+	testCases := []struct {
+		name         string
+		inodeCore    InodeCore
+		expectedData uint64
+		expectedAttr uint64
+	}{
+		{
+			name:         "small extent counters",
+			inodeCore:    InodeCore{Version: 3, Nextents: 5, Anextents: 2},
+			expectedData: 5,
+			expectedAttr: 2,
+		},
+		{
+			name: "large extent counters",
+			inodeCore: InodeCore{
+				Version:   3,
+				Flags2:    XFS_DIFLAG2_NREXT64,
+				Padding:   [8]byte{0xff, 0xff, 0, 0, 0, 1, 0, 0},
+				Flushiter: 3,
+				Nextents:  7,
+			},
+			expectedData: 1<<32 | 3,
+			expectedAttr: 7,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.inodeCore.DataExtents(); got != tt.expectedData {
+				t.Fatalf("name: %s, expected %d, actual %d", tt.name, tt.expectedData, got)
+			}
+			if got := tt.inodeCore.AttrExtents(); got != tt.expectedAttr {
+				t.Fatalf("name: %s, expected %d, actual %d", tt.name, tt.expectedAttr, got)
+			}
+		})
+	}
+}
+
+func TestFileSystem_InodeSize(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts testImageOptions
+	}{
+		{
+			name: "v4 256 bytes inode",
+			opts: testImageOptions{v4: true, inodeSize: 256},
+		},
+		{
+			name: "v5 512 bytes inode",
+			opts: testImageOptions{inodeSize: 512},
+		},
+		{
+			name: "v5 2048 bytes inode",
+			opts: testImageOptions{inodeSize: 2048},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			img := newTestImage(t, tt.opts)
+			xattr := []testXattr{{name: "x", value: []byte("value")}}
+
+			// shortform directory, the attribute fork follows the directory entries
+			dir := img.mkdir(img.root, "dir")
+			dir.xattrs = xattr
+			for _, name := range []string{"a", "b", "c"} {
+				img.file(dir, name, nil)
+			}
+			// 3 extents fill the data fork of 48 bytes
+			extents := img.file(img.root, "extents", bytes.Repeat([]byte("0123456789abcdef"), 3*4096/16))
+			extents.fragment = true
+			extents.xattrs = xattr
+			extents.forkoff = 6
+			// the bmbt root has 4 records at most in the data fork of 72 bytes
+			btree := img.file(img.root, "btree", bytes.Repeat([]byte("fedcba9876543210"), 8*4096/16))
+			btree.fragment = true
+			btree.xattrs = xattr
+			btree.forkoff = 9
+			filesystem := img.fs(WithVerifyMode(VerifyStrict))
+
+			expectedForkoff := map[string]uint8{"extents": 6, "btree": 9}
+			for name, forkoff := range expectedForkoff {
+				stat, err := filesystem.Stat(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if actual := stat.(FileInfo).inode.inodeCore.Forkoff; actual != forkoff {
+					t.Fatalf("name: %s, expected forkoff %d, actual %d", name, forkoff, actual)
+				}
+			}
+			if inode, err := filesystem.ParseInode(btree.ino); err != nil {
+				t.Fatal(err)
+			} else if inode.regularBtree == nil {
+				t.Fatalf("name: %s, expected btree format, actual %d", tt.name, inode.inodeCore.Format)
+			}
+
+			entries, err := filesystem.ReadDir("dir")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			if strings.Join(names, ",") != "a,b,c" {
+				t.Fatalf("name: %s, expected [a b c], actual %v", tt.name, names)
+			}
+
+			for name, in := range map[string]*testInode{"extents": extents, "btree": btree} {
+				buf, err := filesystem.ReadFile(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(buf, in.data) {
+					t.Fatalf("name: %s, unexpected data of %s", tt.name, name)
+				}
+			}
+
+			for _, name := range []string{"dir", "extents", "btree"} {
+				value, err := filesystem.GetXattr(name, "user.x")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(value) != "value" {
+					t.Fatalf("name: %s, expected %q, actual %q", name, "value", value)
+				}
+			}
+		})
+	}
+}
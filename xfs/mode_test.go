@@ -0,0 +1,135 @@
+package xfs
+
+import (
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFileSystem_DeviceMode(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts testImageOptions
+	}{
+		{
+			name: "v5",
+			opts: testImageOptions{},
+		},
+		{
+			name: "v4 without ftype",
+			opts: testImageOptions{v4: true, noFtype: true},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			img := newTestImage(t, tt.opts)
+			img.node(img.root, "chr", 0o20620, 4<<8|1)
+			img.node(img.root, "blk", 0o60660, 8<<8|2)
+			img.node(img.root, "fifo", 0o10644, 0)
+			filesystem := img.fs()
+
+			expected := map[string]fs.FileMode{
+				"chr":  fs.ModeDevice | fs.ModeCharDevice | 0o620,
+				"blk":  fs.ModeDevice | 0o660,
+				"fifo": fs.ModeNamedPipe | 0o644,
+			}
+			for name, mode := range expected {
+				stat, err := filesystem.Stat(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if stat.Mode() != mode {
+					t.Fatalf("name: %s, expected mode %s, actual %s", name, mode, stat.Mode())
+				}
+			}
+
+			entries, err := filesystem.ReadDir(".")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(expected) {
+				t.Fatalf("name: %s, expected %d entries, actual %d", tt.name, len(expected), len(entries))
+			}
+			for _, entry := range entries {
+				if entry.Type() != expected[entry.Name()].Type() {
+					t.Fatalf("name: %s, expected type %s, actual %s", entry.Name(), expected[entry.Name()].Type(), entry.Type())
+				}
+			}
+		})
+	}
+}
+
+func TestFileSystem_OpenSpecialFile(t *testing.T) {
+	img := newTestImage(t, testImageOptions{})
+	dir := img.mkdir(img.root, "dev")
+	img.node(dir, "chr", 0o20620, 4<<8|1)
+	img.node(dir, "blk", 0o60660, 8<<8|2)
+	img.node(img.root, "fifo", 0o10644, 0)
+	img.node(img.root, "sock", 0o140755, 0)
+	img.file(img.root, "file", []byte("data"))
+	filesystem := img.fs()
+
+	if err := fstest.TestFS(filesystem, "dev/chr", "dev/blk", "fifo", "sock", "file"); err != nil {
+		t.Fatal(err)
+	}
+
+	// devices, FIFOs and sockets are read as empty files
+	for _, name := range []string{"dev/chr", "dev/blk", "fifo", "sock"} {
+		f, err := filesystem.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := f.Read(make([]byte, 8)); n != 0 || err != io.EOF {
+			t.Fatalf("name: %s, expected 0 and %v, actual %d and %v", name, io.EOF, n, err)
+		}
+		f.Close()
+	}
+}
+
+func TestFileInfo_Mode(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mode     uint16
+		expected fs.FileMode
+	}{
+		{
+			name:     "setuid",
+			mode:     0o104755,
+			expected: fs.ModeSetuid | 0o755,
+		},
+		{
+			name:     "setgid",
+			mode:     0o102755,
+			expected: fs.ModeSetgid | 0o755,
+		},
+		{
+			name:     "setuid and setgid",
+			mode:     0o106755,
+			expected: fs.ModeSetuid | fs.ModeSetgid | 0o755,
+		},
+		{
+			name:     "sticky directory",
+			mode:     0o41777,
+			expected: fs.ModeDir | fs.ModeSticky | 0o777,
+		},
+		{
+			name:     "setgid directory",
+			mode:     0o42775,
+			expected: fs.ModeDir | fs.ModeSetgid | 0o775,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			info := FileInfo{
+				name:  tt.name,
+				inode: &Inode{inodeCore: InodeCore{Mode: tt.mode}},
+			}
+			if info.Mode() != tt.expected {
+				t.Fatalf("name: %s, expected %s, actual %s", tt.name, tt.expected, info.Mode())
+			}
+		})
+	}
+}
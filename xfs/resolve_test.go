@@ -0,0 +1,171 @@
+package xfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"testing"
+)
+
+func TestFileSystem_ResolveInRoot(t *testing.T) {
+	img := newTestImage(t, testImageOptions{})
+	a := img.mkdir(img.root, "a")
+	b := img.mkdir(a, "b")
+	file := img.file(b, "file", []byte("data"))
+	img.symlink(a, "up", "../../../..")
+	img.symlink(a, "abs", "/a/b")
+	img.symlink(a, "escape", "../../../../a/b/file")
+	img.symlink(img.root, "loop", "loop")
+	// chain1/l00 -> chain1/l01 -> ... -> chain1/l20 -> chain2/l21 -> ... -> chain2/l40 -> a/b/file,
+	// the links are split into 2 directories to keep them in shortform.
+	chain1 := img.mkdir(img.root, "chain1")
+	chain2 := img.mkdir(img.root, "chain2")
+	for i := 0; i < MaxSymlinkFollows; i++ {
+		dir, target := chain1, fmt.Sprintf("l%02d", i+1)
+		if i >= MaxSymlinkFollows/2 {
+			dir = chain2
+		}
+		if i == MaxSymlinkFollows/2 {
+			dir, target = chain1, fmt.Sprintf("../chain2/l%02d", i+1)
+		}
+		img.symlink(dir, fmt.Sprintf("l%02d", i), target)
+	}
+	img.symlink(chain2, fmt.Sprintf("l%02d", MaxSymlinkFollows), "/a/b/file")
+	filesystem := img.fs()
+
+	testCases := []struct {
+		name         string
+		expectedPath string
+		expectedIno  uint64
+		expectedErr  error
+	}{
+		{
+			name:         "/",
+			expectedPath: ".",
+			expectedIno:  img.root.ino,
+		},
+		{
+			name:         "../../a/b/../b/./file",
+			expectedPath: "a/b/file",
+			expectedIno:  file.ino,
+		},
+		{
+			name:         "a/up",
+			expectedPath: ".",
+			expectedIno:  img.root.ino,
+		},
+		{
+			name:         "a/up/a/b",
+			expectedPath: "a/b",
+			expectedIno:  b.ino,
+		},
+		{
+			name:         "a/abs/file",
+			expectedPath: "a/b/file",
+			expectedIno:  file.ino,
+		},
+		{
+			name:         "/a/escape",
+			expectedPath: "a/b/file",
+			expectedIno:  file.ino,
+		},
+		{
+			name:         "a/abs/",
+			expectedPath: "a/b",
+			expectedIno:  b.ino,
+		},
+		{
+			name:         "chain1/l01",
+			expectedPath: "a/b/file",
+			expectedIno:  file.ino,
+		},
+		{
+			name:        "chain1/l00",
+			expectedErr: ErrTooManySymlinks,
+		},
+		{
+			name:        "loop",
+			expectedErr: ErrTooManySymlinks,
+		},
+		{
+			name:        "a/b/file/",
+			expectedErr: fs.ErrNotExist,
+		},
+		{
+			name:        "a/escape/",
+			expectedErr: fs.ErrNotExist,
+		},
+		{
+			name:        "a/b/file/x",
+			expectedErr: fs.ErrNotExist,
+		},
+		{
+			name:        "a/b/nothing",
+			expectedErr: fs.ErrNotExist,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved, err := filesystem.ResolveInRoot(tt.name)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("name: %s, expected error %v, actual %v", tt.name, tt.expectedErr, err)
+				}
+				if _, err := filesystem.Realpath(tt.name); !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("name: %s, expected realpath error %v, actual %v", tt.name, tt.expectedErr, err)
+				}
+				if _, err := filesystem.OpenInRoot(tt.name); !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("name: %s, expected open error %v, actual %v", tt.name, tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resolved.Path != tt.expectedPath {
+				t.Fatalf("name: %s, expected path %s, actual %s", tt.name, tt.expectedPath, resolved.Path)
+			}
+			if resolved.Ino != tt.expectedIno {
+				t.Fatalf("name: %s, expected ino %d, actual %d", tt.name, tt.expectedIno, resolved.Ino)
+			}
+
+			realpath, err := filesystem.Realpath(tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if realpath != tt.expectedPath {
+				t.Fatalf("name: %s, expected realpath %s, actual %s", tt.name, tt.expectedPath, realpath)
+			}
+
+			if tt.expectedIno != file.ino {
+				return
+			}
+			// The resolved path is valid for Open and refers to the same file.
+			f, err := filesystem.OpenInRoot(tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			stat, err := f.Stat()
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := filesystem.Stat(resolved.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stat.Mode() != expected.Mode() || stat.Size() != expected.Size() {
+				t.Fatalf("name: %s, expected %s %d, actual %s %d", tt.name, expected.Mode(), expected.Size(), stat.Mode(), stat.Size())
+			}
+			buf, err := io.ReadAll(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(buf) != "data" {
+				t.Fatalf("name: %s, expected %q, actual %q", tt.name, "data", buf)
+			}
+		})
+	}
+}
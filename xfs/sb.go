@@ -1,5 +1,7 @@
 package xfs
 
+import "encoding/binary"
+
 type SuperBlock struct {
 	Magicnum   uint32
 	BlockSize  uint32
@@ -61,6 +63,58 @@ type SuperBlock struct {
 	MetaUUID            [16]byte
 }
 
+func (sb SuperBlock) Version() uint16 {
+	return sb.Versionnum & XFS_SB_VERSION_NUMBITS
+}
+
+// HasCRC reports whether the filesystem is v5, which has metadata checksums and self describing headers.
+func (sb SuperBlock) HasCRC() bool {
+	return sb.Version() == XFS_SB_VERSION_5
+}
+
+// HasFtype reports whether directory entries have the file type.
+func (sb SuperBlock) HasFtype() bool {
+	if sb.HasCRC() {
+		return sb.FeaturesIncompat&XFS_SB_FEAT_INCOMPAT_FTYPE != 0
+	}
+	return sb.Versionnum&XFS_SB_VERSION_MOREBITSBIT != 0 && sb.Features2&XFS_SB_VERSION2_FTYPE != 0
+}
+
+// DinodeSize returns the size of the inode core, the literal area of the data and attribute forks follows it.
+func (sb SuperBlock) DinodeSize() int {
+	if sb.HasCRC() {
+		return INODEV3_SIZE
+	}
+	return INODEV2_SIZE
+}
+
+// AGFLSize returns the number of entries in the AGFL, the free list fills the sector after the v5 header.
+func (sb SuperBlock) AGFLSize() int {
+	size := int(sb.Sectsize)
+	if sb.HasCRC() {
+		size -= binary.Size(AGFLHdr{})
+	}
+	return size / 4
+}
+
+// BlockToDaddr returns the disk address of the filesystem block n in 512 bytes units.
+func (sb SuperBlock) BlockToDaddr(n uint64) uint64 {
+	return uint64(sb.BlockToPhysicalOffset(n)) << (sb.Blocklog - BBSHIFT)
+}
+
+// metaUUID returns the UUID stamped in the metadata, it differs from UUID after the UUID was changed with meta_uuid feature.
+func (sb SuperBlock) metaUUID() [16]byte {
+	if sb.FeaturesIncompat&XFS_SB_FEAT_INCOMPAT_META_UUID != 0 {
+		return sb.MetaUUID
+	}
+	return sb.UUID
+}
+
+// DirBlockSize returns the size of directory blocks, which can be larger than the filesystem block.
+func (sb SuperBlock) DirBlockSize() uint32 {
+	return sb.BlockSize << sb.Dirblklog
+}
+
 // return (AG number), (Inode Block), (Inode Offset)
 func (sb SuperBlock) InodeOffset(inodeNumber uint64) (int, uint64, uint64) {
 	offsetAddress := sb.Inopblog + sb.Agblklog
@@ -206,3 +206,88 @@ func TestSuperBlock_InodeAbsOffset(t *testing.T) {
 		})
 	}
 }
+
+func TestSuperBlock_AGFLSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		sectsize   uint16
+		versionnum uint16
+		expected   int
+	}{
+		{
+			name:       "v5 512 bytes sector",
+			sectsize:   512,
+			versionnum: xfs.XFS_SB_VERSION_5,
+			expected:   119,
+		},
+		{
+			name:       "v5 4096 bytes sector",
+			sectsize:   4096,
+			versionnum: xfs.XFS_SB_VERSION_5,
+			expected:   1015,
+		},
+		{
+			name:       "v4 512 bytes sector",
+			sectsize:   512,
+			versionnum: xfs.XFS_SB_VERSION_4,
+			expected:   128,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sb := xfs.SuperBlock{
+				Sectsize:   tt.sectsize,
+				Versionnum: tt.versionnum,
+			}
+			if got := sb.AGFLSize(); got != tt.expected {
+				t.Errorf("AGFLSize got = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSuperBlock_HasFtype(t *testing.T) {
+	tests := []struct {
+		name             string
+		versionnum       uint16
+		features2        uint32
+		featuresIncompat uint32
+		expected         bool
+	}{
+		{
+			name:             "v5 with ftype",
+			versionnum:       xfs.XFS_SB_VERSION_5,
+			featuresIncompat: xfs.XFS_SB_FEAT_INCOMPAT_FTYPE,
+			expected:         true,
+		},
+		{
+			name:       "v5 without ftype",
+			versionnum: xfs.XFS_SB_VERSION_5,
+			expected:   false,
+		},
+		{
+			name:       "v4 with ftype",
+			versionnum: xfs.XFS_SB_VERSION_4 | xfs.XFS_SB_VERSION_MOREBITSBIT,
+			features2:  xfs.XFS_SB_VERSION2_FTYPE,
+			expected:   true,
+		},
+		{
+			name:       "v4 features2 without morebits",
+			versionnum: xfs.XFS_SB_VERSION_4,
+			features2:  xfs.XFS_SB_VERSION2_FTYPE,
+			expected:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sb := xfs.SuperBlock{
+				Versionnum:       tt.versionnum,
+				Features2:        tt.features2,
+				FeaturesIncompat: tt.featuresIncompat,
+			}
+			if got := sb.HasFtype(); got != tt.expected {
+				t.Errorf("HasFtype got = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
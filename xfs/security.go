@@ -0,0 +1,215 @@
+package xfs
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	XattrCapability = XattrSecurityPrefix + "capability"
+	XattrSELinux    = XattrSecurityPrefix + "selinux"
+)
+
+// capabilityNames are the names of capabilities used by getcap, indexed by the capability number.
+// https://github.com/torvalds/linux/blob/5bfc75d92efd494db37f5c4c173d3639d4772966/include/uapi/linux/capability.h
+var capabilityNames = []string{
+	"cap_chown",
+	"cap_dac_override",
+	"cap_dac_read_search",
+	"cap_fowner",
+	"cap_fsetid",
+	"cap_kill",
+	"cap_setgid",
+	"cap_setuid",
+	"cap_setpcap",
+	"cap_linux_immutable",
+	"cap_net_bind_service",
+	"cap_net_broadcast",
+	"cap_net_admin",
+	"cap_net_raw",
+	"cap_ipc_lock",
+	"cap_ipc_owner",
+	"cap_sys_module",
+	"cap_sys_rawio",
+	"cap_sys_chroot",
+	"cap_sys_ptrace",
+	"cap_sys_pacct",
+	"cap_sys_admin",
+	"cap_sys_boot",
+	"cap_sys_nice",
+	"cap_sys_resource",
+	"cap_sys_time",
+	"cap_sys_tty_config",
+	"cap_mknod",
+	"cap_lease",
+	"cap_audit_write",
+	"cap_audit_control",
+	"cap_setfcap",
+	"cap_mac_override",
+	"cap_mac_admin",
+	"cap_syslog",
+	"cap_wake_alarm",
+	"cap_block_suspend",
+	"cap_audit_read",
+	"cap_perfmon",
+	"cap_bpf",
+	"cap_checkpoint_restore",
+}
+
+// Capability is the file capability set decoded from vfs_cap_data.
+type Capability struct {
+	// Revision is VFS_CAP_REVISION_1, VFS_CAP_REVISION_2 or VFS_CAP_REVISION_3.
+	Revision    uint32
+	Effective   bool
+	Permitted   uint64
+	Inheritable uint64
+	// RootID is the root uid of the user namespace the capability is valid in, only set in revision 3.
+	RootID uint32
+}
+
+// Capability returns the file capabilities of the named file, ErrNoXattr is returned if the file has none.
+func (xfs *FileSystem) Capability(name string) (*Capability, error) {
+	const op = "capability"
+
+	inode, err := xfs.resolve(name, true)
+	if err != nil {
+		return nil, xfs.wrapError(op, name, xerrors.Errorf("failed to resolve path: %w", err))
+	}
+	value, err := xfs.getXattr(inode, XattrCapability)
+	if err != nil {
+		return nil, xfs.wrapError(op, name, err)
+	}
+	capability, err := parseCapability(value)
+	if err != nil {
+		return nil, xfs.wrapError(op, name, xerrors.Errorf("failed to parse %s: %w", XattrCapability, err))
+	}
+	return capability, nil
+}
+
+// SELinuxContext returns the SELinux security context of the named file, e.g. "system_u:object_r:bin_t:s0".
+// ErrNoXattr is returned if the file is not labeled.
+func (xfs *FileSystem) SELinuxContext(name string) (string, error) {
+	const op = "selinuxcontext"
+
+	inode, err := xfs.resolve(name, true)
+	if err != nil {
+		return "", xfs.wrapError(op, name, xerrors.Errorf("failed to resolve path: %w", err))
+	}
+	value, err := xfs.getXattr(inode, XattrSELinux)
+	if err != nil {
+		return "", xfs.wrapError(op, name, err)
+	}
+	// the context is stored with the terminating NUL
+	return strings.TrimRight(string(value), "\x00"), nil
+}
+
+// parseCapability decodes vfs_cap_data, the fields are little endian unlike the other on-disk structures.
+func parseCapability(buf []byte) (*Capability, error) {
+	if len(buf) < 4 {
+		return nil, xerrors.Errorf("invalid capability size: %d", len(buf))
+	}
+	magic := binary.LittleEndian.Uint32(buf)
+	capability := &Capability{
+		Revision:  magic & VFS_CAP_REVISION_MASK,
+		Effective: magic&VFS_CAP_FLAGS_EFFECTIVE != 0,
+	}
+
+	// data[i] is {permitted, inheritable} of the capabilities 32*i to 32*i+31
+	size, count := XATTR_CAPS_SZ_2, 2
+	switch capability.Revision {
+	case VFS_CAP_REVISION_1:
+		size, count = XATTR_CAPS_SZ_1, 1
+	case VFS_CAP_REVISION_2:
+	case VFS_CAP_REVISION_3:
+		size = XATTR_CAPS_SZ_3
+	default:
+		return nil, xerrors.Errorf("unknown capability revision: %x", capability.Revision)
+	}
+	if len(buf) != size {
+		return nil, xerrors.Errorf("invalid capability size: actual(%d), expected(%d)", len(buf), size)
+	}
+	for i := 0; i < count; i++ {
+		capability.Permitted |= uint64(binary.LittleEndian.Uint32(buf[4+i*8:])) << (32 * i)
+		capability.Inheritable |= uint64(binary.LittleEndian.Uint32(buf[8+i*8:])) << (32 * i)
+	}
+	if capability.Revision == VFS_CAP_REVISION_3 {
+		capability.RootID = binary.LittleEndian.Uint32(buf[XATTR_CAPS_SZ_2:])
+	}
+	return capability, nil
+}
+
+// flags returns the sets having the capability n in the order of libcap, e(1), i(2) and p(4).
+// The effective bit of the file applies to all permitted and inheritable capabilities.
+func (c Capability) flags(n int) int {
+	var flags int
+	if c.Inheritable&(1<<n) != 0 {
+		flags |= 2
+	}
+	if c.Permitted&(1<<n) != 0 {
+		flags |= 4
+	}
+	if c.Effective && flags != 0 {
+		flags |= 1
+	}
+	return flags
+}
+
+// String returns the capability set in the text format of getcap, e.g. "cap_net_admin,cap_net_raw+ep".
+// Same as cap_to_text of libcap, the flags shared by most capabilities are written first as "=flags".
+func (c Capability) String() string {
+	flagString := func(flags int) string {
+		var s string
+		for i, f := range "eip" {
+			if flags&(1<<i) != 0 {
+				s += string(f)
+			}
+		}
+		return s
+	}
+
+	var histogram [8]int
+	for n := range capabilityNames {
+		histogram[c.flags(n)]++
+	}
+	most := 7
+	for t := 6; t >= 0; t-- {
+		if histogram[t] >= histogram[most] {
+			most = t
+		}
+	}
+
+	var clauses []string
+	if most != 0 {
+		clauses = append(clauses, "="+flagString(most))
+	}
+	for t := 7; t >= 0; t-- {
+		if t == most || histogram[t] == 0 {
+			continue
+		}
+		var names []string
+		for n, name := range capabilityNames {
+			if c.flags(n) == t {
+				names = append(names, name)
+			}
+		}
+		clause := strings.Join(names, ",")
+		if added := t &^ most; added != 0 {
+			clause += "+" + flagString(added)
+		}
+		if removed := most &^ t; removed != 0 {
+			clause += "-" + flagString(removed)
+		}
+		clauses = append(clauses, clause)
+	}
+
+	// capabilities unknown to this package are written by the number
+	for n := len(capabilityNames); n < 64; n++ {
+		if flags := c.flags(n); flags != 0 {
+			clauses = append(clauses, strconv.Itoa(n)+"+"+flagString(flags))
+		}
+	}
+	return strings.Join(clauses, " ")
+}
@@ -0,0 +1,93 @@
+package xfs
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestParseCapability(t *testing.T) {
+	encode := func(magic uint32, sets ...uint32) []byte {
+		buf := binary.LittleEndian.AppendUint32(nil, magic)
+		for _, set := range sets {
+			buf = binary.LittleEndian.AppendUint32(buf, set)
+		}
+		return buf
+	}
+	const (
+		netAdmin = 1 << 12
+		netRaw   = 1 << 13
+	)
+
+	testCases := []struct {
+		name           string
+		buf            []byte
+		expected       string
+		expectedRootID uint32
+		expectedErr    bool
+	}{
+		{
+			name:     "v2 effective",
+			buf:      encode(VFS_CAP_REVISION_2|VFS_CAP_FLAGS_EFFECTIVE, netRaw, 0, 0, 0),
+			expected: "cap_net_raw+ep",
+		},
+		{
+			name:     "v2 multiple capabilities",
+			buf:      encode(VFS_CAP_REVISION_2|VFS_CAP_FLAGS_EFFECTIVE, netAdmin|netRaw, netAdmin|netRaw, 0, 0),
+			expected: "cap_net_admin,cap_net_raw+eip",
+		},
+		{
+			name:     "v2 different sets",
+			buf:      encode(VFS_CAP_REVISION_2, netAdmin, netRaw, 0, 0),
+			expected: "cap_net_admin+p cap_net_raw+i",
+		},
+		{
+			name:     "v2 upper capabilities",
+			buf:      encode(VFS_CAP_REVISION_2|VFS_CAP_FLAGS_EFFECTIVE, 0, 0, 1<<(38-32), 0),
+			expected: "cap_perfmon+ep",
+		},
+		{
+			name:     "v1",
+			buf:      encode(VFS_CAP_REVISION_1, netRaw, 0),
+			expected: "cap_net_raw+p",
+		},
+		{
+			name:           "v3 with rootid",
+			buf:            encode(VFS_CAP_REVISION_3|VFS_CAP_FLAGS_EFFECTIVE, netRaw, 0, 0, 0, 1000),
+			expected:       "cap_net_raw+ep",
+			expectedRootID: 1000,
+		},
+		{
+			name:     "all capabilities",
+			buf:      encode(VFS_CAP_REVISION_2|VFS_CAP_FLAGS_EFFECTIVE, 0xffffffff, 0, 0x1ff, 0),
+			expected: "=ep",
+		},
+		{
+			name:        "invalid size",
+			buf:         encode(VFS_CAP_REVISION_3, netRaw, 0, 0, 0),
+			expectedErr: true,
+		},
+		{
+			name:        "unknown revision",
+			buf:         encode(0x04000000, netRaw, 0, 0, 0),
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			capability, err := parseCapability(tt.buf)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("name: %s, expected error %v, actual %v", tt.name, tt.expectedErr, err)
+			}
+			if tt.expectedErr {
+				return
+			}
+			if s := capability.String(); s != tt.expected {
+				t.Errorf("name: %s, expected %q, actual %q", tt.name, tt.expected, s)
+			}
+			if capability.RootID != tt.expectedRootID {
+				t.Errorf("name: %s, expected rootid %d, actual %d", tt.name, tt.expectedRootID, capability.RootID)
+			}
+		})
+	}
+}
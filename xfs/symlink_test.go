@@ -0,0 +1,263 @@
+package xfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+func newSymlinkTestFS(t *testing.T) *FileSystem {
+	img := newTestImage(t, testImageOptions{})
+	dir := img.mkdir(img.root, "dir")
+	img.file(dir, "file", []byte("hello"))
+	img.symlink(dir, "link-file", "file")
+	img.symlink(img.root, "link-dir", "dir")
+	img.symlink(img.root, "abs", "/dir/file")
+	img.symlink(img.root, "dangling", "nothing")
+	img.symlink(img.root, "loop1", "loop2")
+	img.symlink(img.root, "loop2", "loop1")
+	return img.fs()
+}
+
+func TestFileSystem_OpenSymlink(t *testing.T) {
+	filesystem := newSymlinkTestFS(t)
+
+	testCases := []struct {
+		name        string
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "dir/link-file",
+			expected: "hello",
+		},
+		{
+			name:     "link-dir/file",
+			expected: "hello",
+		},
+		{
+			name:     "link-dir/link-file",
+			expected: "hello",
+		},
+		{
+			name:     "abs",
+			expected: "hello",
+		},
+		{
+			name:        "dangling",
+			expectedErr: fs.ErrNotExist,
+		},
+		{
+			name:        "loop1",
+			expectedErr: ErrTooManySymlinks,
+		},
+		{
+			name:        "loop1/file",
+			expectedErr: ErrTooManySymlinks,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := filesystem.Open(tt.name)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("name: %s, expected error %v, actual %v", tt.name, tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			buf, err := io.ReadAll(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(buf) != tt.expected {
+				t.Fatalf("name: %s, expected %q, actual %q", tt.name, tt.expected, buf)
+			}
+		})
+	}
+}
+
+func TestFileSystem_ReadLink(t *testing.T) {
+	filesystem := newSymlinkTestFS(t)
+
+	testCases := []struct {
+		name        string
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "link-dir",
+			expected: "dir",
+		},
+		{
+			name:     "link-dir/link-file",
+			expected: "file",
+		},
+		{
+			name:     "abs",
+			expected: "/dir/file",
+		},
+		{
+			name:     "loop1",
+			expected: "loop2",
+		},
+		{
+			name:        "dir/file",
+			expectedErr: fs.ErrInvalid,
+		},
+		{
+			name:        "nothing",
+			expectedErr: fs.ErrNotExist,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := filesystem.ReadLink(tt.name)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("name: %s, expected error %v, actual %v", tt.name, tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if target != tt.expected {
+				t.Fatalf("name: %s, expected %q, actual %q", tt.name, tt.expected, target)
+			}
+		})
+	}
+}
+
+func TestFileSystem_Lstat(t *testing.T) {
+	filesystem := newSymlinkTestFS(t)
+
+	testCases := []struct {
+		name          string
+		expectedStat  fs.FileMode
+		expectedLstat fs.FileMode
+		expectedSize  int64
+	}{
+		{
+			name:          "link-dir",
+			expectedStat:  fs.ModeDir | 0o755,
+			expectedLstat: fs.ModeSymlink | 0o777,
+			expectedSize:  int64(len("dir")),
+		},
+		{
+			name:          "link-dir/link-file",
+			expectedStat:  0o644,
+			expectedLstat: fs.ModeSymlink | 0o777,
+			expectedSize:  int64(len("file")),
+		},
+		{
+			name:          "dir/file",
+			expectedStat:  0o644,
+			expectedLstat: 0o644,
+			expectedSize:  int64(len("hello")),
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			stat, err := filesystem.Stat(tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stat.Mode() != tt.expectedStat {
+				t.Fatalf("name: %s, expected stat mode %s, actual %s", tt.name, tt.expectedStat, stat.Mode())
+			}
+			lstat, err := filesystem.Lstat(tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lstat.Mode() != tt.expectedLstat {
+				t.Fatalf("name: %s, expected lstat mode %s, actual %s", tt.name, tt.expectedLstat, lstat.Mode())
+			}
+			if lstat.Size() != tt.expectedSize {
+				t.Fatalf("name: %s, expected lstat size %d, actual %d", tt.name, tt.expectedSize, lstat.Size())
+			}
+		})
+	}
+
+	if _, err := filesystem.Lstat("loop1/file"); !errors.Is(err, ErrTooManySymlinks) {
+		t.Fatalf("expected error %v, actual %v", ErrTooManySymlinks, err)
+	}
+}
+
+func TestFileSystem_ReadLinkRemote(t *testing.T) {
+	testCases := []struct {
+		name     string
+		opts     testImageOptions
+		target   string
+		fragment bool
+	}{
+		{
+			name:   "v5",
+			target: strings.Repeat("0123456789/", 90),
+		},
+		{
+			name:   "v5 target of MAXPATHLEN",
+			target: strings.Repeat("a/", 512),
+		},
+		{
+			// a mapping of 2 blocks has one header, 1024 - 56 bytes of the target
+			name:   "v5 with one header in the mapping of 2 blocks",
+			opts:   testImageOptions{blockSize: 512},
+			target: strings.Repeat("0123456789/", 88),
+		},
+		{
+			name:     "v5 with a header in each extent",
+			opts:     testImageOptions{blockSize: 512},
+			target:   strings.Repeat("0123456789/", 90),
+			fragment: true,
+		},
+		{
+			name:   "v4",
+			opts:   testImageOptions{v4: true},
+			target: strings.Repeat("0123456789/", 90),
+		},
+		{
+			name:   "v4 two blocks",
+			opts:   testImageOptions{v4: true, blockSize: 512},
+			target: strings.Repeat("0123456789/", 90),
+		},
+		{
+			name:     "v4 two extents",
+			opts:     testImageOptions{v4: true, blockSize: 512},
+			target:   strings.Repeat("0123456789/", 90),
+			fragment: true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			img := newTestImage(t, tt.opts)
+			link := img.symlink(img.root, "link", tt.target)
+			link.fragment = tt.fragment
+			filesystem := img.fs(WithVerifyMode(VerifyStrict))
+
+			inode, err := filesystem.ParseInode(link.ino)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inode.inodeCore.Format != XFS_DINODE_FMT_EXTENTS {
+				t.Fatalf("name: %s, expected extents format, actual %d", tt.name, inode.inodeCore.Format)
+			}
+			actual, err := filesystem.ReadLink("link")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != tt.target {
+				t.Fatalf("name: %s, expected %q, actual %q", tt.name, tt.target, actual)
+			}
+		})
+	}
+}
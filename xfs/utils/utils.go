@@ -8,6 +8,9 @@ import (
 )
 
 const (
+	// BlockSize is the block size read by ReadBlock.
+	//
+	// Deprecated: the block size is in the superblock, use ReadBlockSize.
 	BlockSize  = 4096
 	SectorSize = 512
 )
@@ -63,9 +66,17 @@ func (c sectorReader) ReadSector(r io.Reader) ([]byte, error) {
 	return buf, nil
 }
 
+// ReadBlock reads a block of BlockSize.
+//
+// Deprecated: use ReadBlockSize with the block size of the superblock.
 func ReadBlock(r io.Reader) ([]byte, error) {
-	buf := make([]byte, 0, BlockSize)
-	for i := 0; i < BlockSize/SectorSize; i++ {
+	return ReadBlockSize(r, BlockSize)
+}
+
+// ReadBlockSize reads a filesystem block of blockSize, blockSize is a multiple of SectorSize.
+func ReadBlockSize(r io.Reader, blockSize int) ([]byte, error) {
+	buf := make([]byte, 0, blockSize)
+	for i := 0; i < blockSize/SectorSize; i++ {
 		b, err := readSector(r)
 		if err != nil {
 			return nil, xerrors.Errorf("failed to read block: %w", err)
@@ -74,8 +85,8 @@ func ReadBlock(r io.Reader) ([]byte, error) {
 		buf = append(buf, b...)
 	}
 
-	if len(buf) != BlockSize {
-		return nil, fmt.Errorf("block size error, expected(%d), actual(%d)", BlockSize, len(buf))
+	if len(buf) != blockSize {
+		return nil, fmt.Errorf("block size error, expected(%d), actual(%d)", blockSize, len(buf))
 	}
 
 	return buf, nil
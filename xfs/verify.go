@@ -0,0 +1,207 @@
+package xfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/masahiro331/go-xfs-filesystem/log"
+)
+
+// VerifyMode selects how the corrupted metadata of v5 filesystem is handled.
+// The CRC32c and the self describing fields, blkno, owner and UUID, of the metadata are verified on read.
+type VerifyMode int
+
+const (
+	// VerifyLenient logs a warning with the inode or block number and reads the metadata anyway.
+	// The warning is replaced by the handler set with WithCorruptionHandler.
+	VerifyLenient VerifyMode = iota
+	// VerifyStrict fails the read with CorruptionError.
+	VerifyStrict
+)
+
+// CorruptionError describes the corrupted metadata, it wraps ErrCorrupted.
+type CorruptionError struct {
+	// What names the metadata, e.g. "inode 128" or "agf of AG 1".
+	What string
+	// Problems is the mismatched fields, e.g. "owner mismatch: actual(129), expected(128)".
+	Problems []string
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.What, strings.Join(e.Problems, ", "), ErrCorrupted)
+}
+
+func (e *CorruptionError) Unwrap() error {
+	return ErrCorrupted
+}
+
+// Option configures the FileSystem created by NewFS.
+type Option func(*FileSystem)
+
+// WithVerifyMode sets how the corrupted metadata is handled, the default is VerifyLenient.
+func WithVerifyMode(mode VerifyMode) Option {
+	return func(xfs *FileSystem) {
+		xfs.verifyMode = mode
+	}
+}
+
+// WithCorruptionHandler sets the handler called with *CorruptionError for the corrupted metadata in VerifyLenient mode,
+// instead of logging a warning. The metadata is read anyway after the handler returns.
+func WithCorruptionHandler(handler func(error)) Option {
+	return func(xfs *FileSystem) {
+		xfs.corruptionHandler = handler
+	}
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// metaFields is the offsets of the self describing fields in the v5 metadata.
+// A field is zero if the metadata doesn't have it, no self describing field is at the head of the metadata.
+type metaFields struct {
+	crc   int
+	blkno int
+	uuid  int
+	// owner is the inode number (be64), seqno is the AG number (be32).
+	owner int
+	seqno int
+}
+
+// https://github.com/torvalds/linux/blob/5bfc75d92efd494db37f5c4c173d3639d4772966/fs/xfs/libxfs/xfs_format.h
+// https://github.com/torvalds/linux/blob/5bfc75d92efd494db37f5c4c173d3639d4772966/fs/xfs/libxfs/xfs_da_format.h
+var (
+	sbFields     = metaFields{crc: XFS_SB_CRC_OFF}
+	agfFields    = metaFields{crc: XFS_AGF_CRC_OFF, uuid: 64, seqno: 8}
+	agiFields    = metaFields{crc: XFS_AGI_CRC_OFF, uuid: 296, seqno: 8}
+	agflFields   = metaFields{crc: XFS_AGFL_CRC_OFF, uuid: 8, seqno: 4}
+	dinodeFields = metaFields{crc: XFS_DINODE_CRC_OFF, owner: 152, uuid: 160}
+	bmbtFields   = metaFields{crc: XFS_BTREE_LBLOCK_CRC_OFF, blkno: 24, uuid: 40, owner: 56}
+	// Dir3BlkHdr of data and block directory blocks
+	dir3BlkFields = metaFields{crc: XFS_DIR3_DATA_CRC_OFF, blkno: 8, uuid: 24, owner: 40}
+	// Da3Blkinfo of leaf, node and attribute leaf blocks
+	da3BlkFields = metaFields{crc: XFS_DA3_NODE_CRC_OFF, blkno: 16, uuid: 32, owner: 48}
+	// Attr3RmtHdr and DsymlinkHdr
+	rmtFields = metaFields{crc: XFS_ATTR3_RMT_CRC_OFF, uuid: 16, owner: 32, blkno: 40}
+)
+
+// verifyMetadata verifies the CRC32c and the self describing fields of the v5 metadata buf.
+// daddr is the disk address of buf, owner is the inode number or the AG number which owns buf.
+// what names the metadata in the error and the warning, e.g. "inode 128".
+func (xfs *FileSystem) verifyMetadata(what string, buf []byte, fields metaFields, daddr, owner uint64) error {
+	sb := xfs.PrimaryAG.SuperBlock
+	if !sb.HasCRC() {
+		return nil
+	}
+
+	var problems []string
+	if expected, actual := binary.LittleEndian.Uint32(buf[fields.crc:]), metadataCRC(buf, fields.crc); actual != expected {
+		problems = append(problems, fmt.Sprintf("crc mismatch: actual(%08x), expected(%08x)", actual, expected))
+	}
+	if fields.blkno != 0 {
+		if blkno := binary.BigEndian.Uint64(buf[fields.blkno:]); blkno != daddr {
+			problems = append(problems, fmt.Sprintf("blkno mismatch: actual(%d), expected(%d)", blkno, daddr))
+		}
+	}
+	if fields.uuid != 0 {
+		if uuid := sb.metaUUID(); !bytes.Equal(buf[fields.uuid:fields.uuid+len(uuid)], uuid[:]) {
+			problems = append(problems, fmt.Sprintf("uuid mismatch: actual(%x), expected(%x)", buf[fields.uuid:fields.uuid+len(uuid)], uuid))
+		}
+	}
+	if fields.owner != 0 {
+		if actual := binary.BigEndian.Uint64(buf[fields.owner:]); actual != owner {
+			problems = append(problems, fmt.Sprintf("owner mismatch: actual(%d), expected(%d)", actual, owner))
+		}
+	}
+	if fields.seqno != 0 {
+		if seqno := binary.BigEndian.Uint32(buf[fields.seqno:]); uint64(seqno) != owner {
+			problems = append(problems, fmt.Sprintf("seqno mismatch: actual(%d), expected(%d)", seqno, owner))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+
+	err := &CorruptionError{What: what, Problems: problems}
+	switch {
+	case xfs.verifyMode == VerifyStrict:
+		return err
+	case xfs.corruptionHandler != nil:
+		xfs.corruptionHandler(err)
+	default:
+		log.Logger.Warnf("%s is corrupted: %s", what, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// metadataCRC returns the CRC32c of buf, the CRC field at offset is calculated as zero.
+// https://github.com/torvalds/linux/blob/5bfc75d92efd494db37f5c4c173d3639d4772966/fs/xfs/libxfs/xfs_cksum.h
+func metadataCRC(buf []byte, offset int) uint32 {
+	crc := crc32.Update(0, castagnoli, buf[:offset])
+	crc = crc32.Update(crc, castagnoli, make([]byte, 4))
+	return crc32.Update(crc, castagnoli, buf[offset+4:])
+}
+
+// verifyAG verifies the AG headers of the AG agno.
+func (xfs *FileSystem) verifyAG(agno uint64, sectors agSectors) error {
+	headers := []struct {
+		name   string
+		buf    []byte
+		fields metaFields
+	}{
+		{"superblock", sectors.sb, sbFields},
+		{"agf", sectors.agf, agfFields},
+		{"agi", sectors.agi, agiFields},
+		{"agfl", sectors.agfl, agflFields},
+	}
+	for _, h := range headers {
+		if err := xfs.verifyMetadata(fmt.Sprintf("%s of AG %d", h.name, agno), h.buf, h.fields, 0, agno); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyDaBlock verifies the directory or attribute block buf read from the logical block, the header is selected by the magic.
+// Unknown magic is not verified, the callers check the magic.
+func (xfs *FileSystem) verifyDaBlock(bmap *blockMap, block uint64, buf []byte) error {
+	if !xfs.PrimaryAG.SuperBlock.HasCRC() {
+		return nil
+	}
+	var fields metaFields
+	var info Da3Blkinfo
+	switch magic := binary.BigEndian.Uint32(buf); magic {
+	case XFS_DIR3_DATA_MAGIC, XFS_DIR3_BLOCK_MAGIC:
+		fields = dir3BlkFields
+	default:
+		if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &info); err != nil {
+			return xerrors.Errorf("failed to read da block info: %w", err)
+		}
+		switch info.Magic {
+		case XFS_DIR3_LEAF1_MAGIC, XFS_DIR3_LEAFN_MAGIC, XFS_DA3_NODE_MAGIC, XFS_ATTR3_LEAF_MAGIC:
+			fields = da3BlkFields
+		default:
+			return nil
+		}
+	}
+	daddr, err := bmap.daddr(block)
+	if err != nil {
+		return xerrors.Errorf("failed to lookup block %d: %w", block, err)
+	}
+	return xfs.verifyMetadata(fmt.Sprintf("block %d of inode %d", block, bmap.owner), buf, fields, daddr, bmap.owner)
+}
+
+// readDaBlock reads count blocks from the logical block like readLogicalBlocks, and verifies them as a directory or attribute block.
+func (xfs *FileSystem) readDaBlock(bmap *blockMap, block, count uint64) ([]byte, error) {
+	buf, err := xfs.readLogicalBlocks(bmap, block, count)
+	if err != nil {
+		return nil, err
+	}
+	if err := xfs.verifyDaBlock(bmap, block, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
@@ -0,0 +1,440 @@
+package xfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestFileSystem_verifyMetadata(t *testing.T) {
+	uuid := [16]byte{0: 0x12, 15: 0x34}
+	sb := SuperBlock{Versionnum: XFS_SB_VERSION_5, UUID: uuid}
+
+	// a bmbt block of inode 128 at disk address 80
+	block := func() []byte {
+		buf := make([]byte, 4096)
+		binary.BigEndian.PutUint32(buf, XFS_BMAP_CRC_MAGIC)
+		binary.BigEndian.PutUint64(buf[24:], 80)
+		copy(buf[40:], uuid[:])
+		binary.BigEndian.PutUint64(buf[56:], 128)
+		binary.LittleEndian.PutUint32(buf[XFS_BTREE_LBLOCK_CRC_OFF:], crc32.Checksum(buf, castagnoli))
+		return buf
+	}
+
+	testCases := []struct {
+		name        string
+		modify      func(buf []byte)
+		mode        VerifyMode
+		expectedErr bool
+	}{
+		{
+			name:   "valid block",
+			modify: func(buf []byte) {},
+			mode:   VerifyStrict,
+		},
+		{
+			name:        "crc mismatch",
+			modify:      func(buf []byte) { buf[4095] ^= 1 },
+			mode:        VerifyStrict,
+			expectedErr: true,
+		},
+		{
+			name:        "owner mismatch",
+			modify:      func(buf []byte) { binary.BigEndian.PutUint64(buf[56:], 129) },
+			mode:        VerifyStrict,
+			expectedErr: true,
+		},
+		{
+			name:   "lenient mode",
+			modify: func(buf []byte) { buf[4095] ^= 1 },
+			mode:   VerifyLenient,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			xfs := &FileSystem{PrimaryAG: AG{SuperBlock: sb}, verifyMode: tt.mode}
+			buf := block()
+			tt.modify(buf)
+			err := xfs.verifyMetadata("bmbt block", buf, bmbtFields, 80, 128)
+			if tt.expectedErr != xerrors.Is(err, ErrCorrupted) {
+				t.Fatalf("name: %s, expected error %t, actual %v", tt.name, tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestFileSystem_verifyAG(t *testing.T) {
+	img := newTestImage(t, testImageOptions{sectSize: 1024}).build()
+	// readSectors returns a copy of the AG headers of the AG agno.
+	readSectors := func(t *testing.T, agno int64) agSectors {
+		agSize := int64(2048 * 4096)
+		r := io.NewSectionReader(bytes.NewReader(append([]byte(nil), img...)), agno*agSize, agSize)
+		_, sectors, err := parseAG(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sectors
+	}
+
+	testCases := []struct {
+		name             string
+		agno             uint64
+		sectorsOf        int64
+		modify           func(sectors agSectors)
+		expectedWhat     string
+		expectedProblems []string
+	}{
+		{
+			name: "valid AG 0",
+			agno: 0,
+		},
+		{
+			name:      "valid AG 1",
+			agno:      1,
+			sectorsOf: 1,
+		},
+		{
+			name:      "headers of AG 1 read as AG 0",
+			agno:      0,
+			sectorsOf: 1,
+			// the superblock has no seqno, agf is verified first
+			expectedWhat:     "agf of AG 0",
+			expectedProblems: []string{"seqno mismatch: actual(1), expected(0)"},
+		},
+		{
+			name:             "superblock crc",
+			modify:           func(sectors agSectors) { sectors.sb[XFS_SB_CRC_OFF] ^= 1 },
+			expectedWhat:     "superblock of AG 0",
+			expectedProblems: []string{"crc mismatch"},
+		},
+		{
+			name: "agf uuid",
+			modify: func(sectors agSectors) {
+				sectors.agf[64] ^= 1
+				setTestCRC(sectors.agf, XFS_AGF_CRC_OFF)
+			},
+			expectedWhat:     "agf of AG 0",
+			expectedProblems: []string{"uuid mismatch"},
+		},
+		{
+			name: "agi seqno",
+			modify: func(sectors agSectors) {
+				binary.BigEndian.PutUint32(sectors.agi[8:], 3)
+				setTestCRC(sectors.agi, XFS_AGI_CRC_OFF)
+			},
+			expectedWhat:     "agi of AG 0",
+			expectedProblems: []string{"seqno mismatch: actual(3), expected(0)"},
+		},
+		{
+			name:             "agi uuid without crc update",
+			modify:           func(sectors agSectors) { sectors.agi[296] ^= 1 },
+			expectedWhat:     "agi of AG 0",
+			expectedProblems: []string{"crc mismatch", "uuid mismatch"},
+		},
+		{
+			name: "agfl seqno and uuid",
+			modify: func(sectors agSectors) {
+				binary.BigEndian.PutUint32(sectors.agfl[4:], 1)
+				sectors.agfl[8] ^= 1
+				setTestCRC(sectors.agfl, XFS_AGFL_CRC_OFF)
+			},
+			expectedWhat:     "agfl of AG 0",
+			expectedProblems: []string{"uuid mismatch", "seqno mismatch: actual(1), expected(0)"},
+		},
+		{
+			// the headers are in the sectors of 1024 bytes, the crc covers the whole sector
+			name:             "agfl crc at the end of the sector",
+			modify:           func(sectors agSectors) { sectors.agfl[1023] ^= 1 },
+			expectedWhat:     "agfl of AG 0",
+			expectedProblems: []string{"crc mismatch"},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			sectors := readSectors(t, tt.sectorsOf)
+			if tt.modify != nil {
+				tt.modify(sectors)
+			}
+			xfs := &FileSystem{verifyMode: VerifyStrict}
+			xfs.PrimaryAG.SuperBlock = mustParseSuperBlock(t, sectors.sb)
+			err := xfs.verifyAG(tt.agno, sectors)
+			assertCorruption(t, tt.name, err, tt.expectedWhat, tt.expectedProblems)
+		})
+	}
+}
+
+func TestFileSystem_verifyBlocks(t *testing.T) {
+	img := newTestImage(t, testImageOptions{})
+	block := img.mkdir(img.root, "block")
+	block.dirFormat = "block"
+	leaf := img.mkdir(img.root, "leaf")
+	leaf.dirFormat = "leaf"
+	for i := 0; i < 200; i++ {
+		img.file(leaf, strings.Repeat("x", 40)+string(rune('a'+i%26))+strings.Repeat("y", i/26), nil)
+	}
+	link := img.symlink(img.root, "link", strings.Repeat("0123456789/", 600))
+	filesystem := img.fs(WithVerifyMode(VerifyStrict))
+
+	// fsb returns the filesystem block mapped at the logical block of the data fork of the inode.
+	fsb := func(t *testing.T, ino, logical uint64) uint64 {
+		inode, err := filesystem.ParseInode(ino)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var recs []BmbtRec
+		switch {
+		case inode.directoryExtents != nil:
+			recs = inode.directoryExtents.bmbtRecs
+		default:
+			// the remote symlink is mapped by the extents in the data fork
+			off := img.inodeOffset(ino) + img.coreSize
+			for i := 0; i < int(inode.inodeCore.Nextents); i++ {
+				var rec BmbtRec
+				if err := binary.Read(bytes.NewReader(img.img[off+i*16:]), binary.BigEndian, &rec); err != nil {
+					t.Fatal(err)
+				}
+				recs = append(recs, rec)
+			}
+		}
+		for _, rec := range recs {
+			p := rec.Unpack()
+			if p.StartOff <= logical && logical < p.StartOff+p.BlockCount {
+				return p.StartBlock + logical - p.StartOff
+			}
+		}
+		t.Fatalf("logical block %d of inode %d is not mapped", logical, ino)
+		return 0
+	}
+	leafBlock := uint64(XFS_DIR2_LEAF_OFFSET) / 4096
+
+	testCases := []struct {
+		name             string
+		read             func() error
+		corrupt          func(t *testing.T) []byte
+		crcOffset        int
+		modify           func(buf []byte)
+		expectedWhat     string
+		expectedProblems []string
+	}{
+		{
+			name: "dinode owner",
+			read: func() error {
+				_, err := filesystem.ParseInode(block.ino)
+				return err
+			},
+			corrupt: func(t *testing.T) []byte {
+				off := img.inodeOffset(block.ino)
+				return img.img[off : off+512]
+			},
+			crcOffset:        XFS_DINODE_CRC_OFF,
+			modify:           func(buf []byte) { binary.BigEndian.PutUint64(buf[152:], block.ino+1) },
+			expectedWhat:     "inode " + itoa(block.ino),
+			expectedProblems: []string{"owner mismatch"},
+		},
+		{
+			name: "dinode uuid",
+			read: func() error {
+				_, err := filesystem.ParseInode(block.ino)
+				return err
+			},
+			corrupt: func(t *testing.T) []byte {
+				off := img.inodeOffset(block.ino)
+				return img.img[off : off+512]
+			},
+			crcOffset:        XFS_DINODE_CRC_OFF,
+			modify:           func(buf []byte) { buf[160] ^= 1 },
+			expectedWhat:     "inode " + itoa(block.ino),
+			expectedProblems: []string{"uuid mismatch"},
+		},
+		{
+			name: "dir3 data block blkno",
+			read: func() error {
+				_, err := filesystem.ReadDir("block")
+				return err
+			},
+			corrupt:          func(t *testing.T) []byte { return img.block(fsb(t, block.ino, 0)) },
+			crcOffset:        XFS_DIR3_DATA_CRC_OFF,
+			modify:           func(buf []byte) { binary.BigEndian.PutUint64(buf[8:], 1) },
+			expectedWhat:     "block 0 of inode " + itoa(block.ino),
+			expectedProblems: []string{"blkno mismatch: actual(1)"},
+		},
+		{
+			name: "dir3 data block crc",
+			read: func() error {
+				_, err := filesystem.ReadDir("block")
+				return err
+			},
+			corrupt:          func(t *testing.T) []byte { return img.block(fsb(t, block.ino, 0)) },
+			modify:           func(buf []byte) { buf[100] ^= 1 },
+			expectedWhat:     "block 0 of inode " + itoa(block.ino),
+			expectedProblems: []string{"crc mismatch"},
+		},
+		{
+			name: "da3 leaf block owner",
+			read: func() error {
+				_, err := filesystem.Stat("leaf/" + strings.Repeat("x", 40) + "a")
+				return err
+			},
+			corrupt:          func(t *testing.T) []byte { return img.block(fsb(t, leaf.ino, leafBlock)) },
+			crcOffset:        XFS_DA3_NODE_CRC_OFF,
+			modify:           func(buf []byte) { binary.BigEndian.PutUint64(buf[48:], 1) },
+			expectedWhat:     "block " + itoa(leafBlock) + " of inode " + itoa(leaf.ino),
+			expectedProblems: []string{"owner mismatch: actual(1)"},
+		},
+		{
+			name: "da3 leaf block uuid",
+			read: func() error {
+				_, err := filesystem.Stat("leaf/" + strings.Repeat("x", 40) + "a")
+				return err
+			},
+			corrupt:          func(t *testing.T) []byte { return img.block(fsb(t, leaf.ino, leafBlock)) },
+			crcOffset:        XFS_DA3_NODE_CRC_OFF,
+			modify:           func(buf []byte) { buf[32] ^= 1 },
+			expectedWhat:     "block " + itoa(leafBlock) + " of inode " + itoa(leaf.ino),
+			expectedProblems: []string{"uuid mismatch"},
+		},
+		{
+			// the crc of the symlink covers the whole mapping of 2 blocks
+			name: "symlink crc in the second block of the mapping",
+			read: func() error {
+				_, err := filesystem.ReadLink("link")
+				return err
+			},
+			corrupt:          func(t *testing.T) []byte { return img.block(fsb(t, link.ino, 1)) },
+			modify:           func(buf []byte) { buf[100] ^= 1 },
+			expectedWhat:     "symlink block " + itoa(fsb(t, link.ino, 0)) + " of inode " + itoa(link.ino),
+			expectedProblems: []string{"crc mismatch"},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.read(); err != nil {
+				t.Fatalf("name: %s, unexpected error before corruption: %s", tt.name, err)
+			}
+			buf := tt.corrupt(t)
+			orig := append([]byte(nil), buf...)
+			defer copy(buf, orig)
+			tt.modify(buf)
+			if tt.crcOffset != 0 {
+				setTestCRC(buf, tt.crcOffset)
+			}
+			assertCorruption(t, tt.name, tt.read(), tt.expectedWhat, tt.expectedProblems)
+		})
+	}
+}
+
+func TestFileSystem_verifyMetaUUID(t *testing.T) {
+	metaUUID := []byte("fedcba9876543210")
+
+	img := newTestImage(t, testImageOptions{metaUUID: metaUUID})
+	dir := img.mkdir(img.root, "dir")
+	dir.dirFormat = "block"
+	img.file(dir, "file", []byte("data"))
+	filesystem := img.fs(WithVerifyMode(VerifyStrict))
+
+	sb := filesystem.PrimaryAG.SuperBlock
+	if bytes.Equal(sb.UUID[:], metaUUID) || !bytes.Equal(sb.MetaUUID[:], metaUUID) {
+		t.Fatalf("expected uuid %x and meta_uuid %x, actual %x and %x", testUUID, metaUUID, sb.UUID, sb.MetaUUID)
+	}
+	buf, err := filesystem.ReadFile("dir/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "data" {
+		t.Fatalf("expected %q, actual %q", "data", buf)
+	}
+
+	// the metadata stamped with the filesystem UUID is corrupted when meta_uuid is enabled
+	off := img.inodeOffset(dir.ino)
+	inode := img.img[off : off+512]
+	copy(inode[160:], testUUID[:])
+	setTestCRC(inode, XFS_DINODE_CRC_OFF)
+	_, err = filesystem.ParseInode(dir.ino)
+	assertCorruption(t, "meta_uuid", err, "inode "+itoa(dir.ino), []string{"uuid mismatch"})
+}
+
+func TestWithCorruptionHandler(t *testing.T) {
+	img := newTestImage(t, testImageOptions{})
+	file := img.file(img.root, "file", []byte("data"))
+	filesystem := img.fs()
+
+	var corruptions []error
+	WithCorruptionHandler(func(err error) {
+		corruptions = append(corruptions, err)
+	})(filesystem)
+
+	off := img.inodeOffset(file.ino)
+	img.img[off+XFS_DINODE_CRC_OFF] ^= 1
+
+	// lenient mode reads the corrupted metadata and reports it to the handler
+	buf, err := filesystem.ReadFile("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "data" {
+		t.Fatalf("expected %q, actual %q", "data", buf)
+	}
+	if len(corruptions) != 1 {
+		t.Fatalf("expected 1 corruption, actual %v", corruptions)
+	}
+	assertCorruption(t, "handler", corruptions[0], "inode "+itoa(file.ino), []string{"crc mismatch"})
+
+	// strict mode returns the error instead of calling the handler
+	WithVerifyMode(VerifyStrict)(filesystem)
+	_, err = filesystem.ReadFile("file")
+	assertCorruption(t, "strict", err, "inode "+itoa(file.ino), []string{"crc mismatch"})
+	if len(corruptions) != 1 {
+		t.Fatalf("expected the handler is not called in strict mode, actual %v", corruptions)
+	}
+}
+
+// assertCorruption checks err is CorruptionError of what with the problems, or nil if what is empty.
+// The problems are compared by the prefix.
+func assertCorruption(t *testing.T, name string, err error, what string, problems []string) {
+	t.Helper()
+
+	if what == "" {
+		if err != nil {
+			t.Fatalf("name: %s, unexpected error: %s", name, err)
+		}
+		return
+	}
+	var corruption *CorruptionError
+	if !xerrors.As(err, &corruption) || !xerrors.Is(err, ErrCorrupted) {
+		t.Fatalf("name: %s, expected CorruptionError, actual %v", name, err)
+	}
+	if corruption.What != what {
+		t.Fatalf("name: %s, expected %q, actual %q", name, what, corruption.What)
+	}
+	if len(corruption.Problems) != len(problems) {
+		t.Fatalf("name: %s, expected %v, actual %v", name, problems, corruption.Problems)
+	}
+	for i := range problems {
+		if !strings.HasPrefix(corruption.Problems[i], problems[i]) {
+			t.Fatalf("name: %s, expected %v, actual %v", name, problems, corruption.Problems)
+		}
+	}
+}
+
+func mustParseSuperBlock(t *testing.T, buf []byte) SuperBlock {
+	t.Helper()
+
+	sb, err := parseSuperBlock(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sb
+}
+
+func itoa(n uint64) string {
+	return strconv.FormatUint(n, 10)
+}
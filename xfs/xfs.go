@@ -1,11 +1,11 @@
 package xfs
 
 import (
-	"bytes"
 	"io"
 	"io/fs"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -15,17 +15,35 @@ import (
 )
 
 var (
-	_ fs.FS        = &FileSystem{}
-	_ fs.ReadDirFS = &FileSystem{}
-	_ fs.StatFS    = &FileSystem{}
-
-	_ fs.File     = &File{}
-	_ fs.FileInfo = &FileInfo{}
-	_ fs.DirEntry = dirEntry{}
-
+	_ fs.FS         = &FileSystem{}
+	_ fs.ReadDirFS  = &FileSystem{}
+	_ fs.ReadFileFS = &FileSystem{}
+	_ fs.StatFS     = &FileSystem{}
+	_ fs.GlobFS     = &FileSystem{}
+	_ fs.SubFS      = &FileSystem{}
+	_ fs.ReadLinkFS = &FileSystem{}
+
+	_ fs.File        = &File{}
+	_ io.ReaderAt    = &File{}
+	_ io.Seeker      = &File{}
+	_ fs.ReadDirFile = &Dir{}
+	_ fs.FileInfo    = &FileInfo{}
+	_ fs.DirEntry    = dirEntry{}
+
+	ErrTooManySymlinks = xerrors.New("too many levels of symbolic links")
+	ErrIsDir           = xerrors.New("is a directory")
+	ErrNoData          = xerrors.New("no data or hole at or after offset")
+	ErrNoXattr         = xerrors.New("no such extended attribute")
+	ErrCorrupted       = xerrors.New("metadata corruption detected")
+
+	// Deprecated: symlinks are followed by Open, ErrOpenSymlink is no longer returned.
 	ErrOpenSymlink = xerrors.New("symlink open not support")
 )
 
+// MaxSymlinkFollows is the maximum number of symbolic links followed while
+// resolving a single path, same as MAXSYMLINKS in Linux.
+const MaxSymlinkFollows = 40
+
 var (
 	ErrReadSizeFormat   = "failed to read size error: actual(%d), expected(%d)"
 	ErrSeekOffsetFormat = "failed to seek offset error: actual(%d), expected(%d)"
@@ -37,7 +55,10 @@ type FileSystem struct {
 	PrimaryAG AG
 	AGs       []AG
 
-	cache Cache[string, any]
+	cache      Cache[string, any]
+	verifyMode VerifyMode
+	// corruptionHandler is called with the corrupted metadata in VerifyLenient mode.
+	corruptionHandler func(error)
 }
 
 func Check(r io.Reader) bool {
@@ -48,11 +69,14 @@ func Check(r io.Reader) bool {
 	return true
 }
 
-func NewFS(r io.SectionReader, cache Cache[string, any]) (*FileSystem, error) {
-	primaryAG, err := ParseAG(&r)
+func NewFS(r io.SectionReader, cache Cache[string, any], opts ...Option) (*FileSystem, error) {
+	primaryAG, sectors, err := parseAG(&r)
 	if err != nil {
 		return nil, xerrors.Errorf("failed to parse primary allocation group: %w", err)
 	}
+	if err := primaryAG.SuperBlock.checkFeatures(); err != nil {
+		return nil, xerrors.Errorf("failed to check filesystem features: %w", err)
+	}
 
 	if cache == nil {
 		cache = &mockCache[string, any]{}
@@ -63,6 +87,12 @@ func NewFS(r io.SectionReader, cache Cache[string, any]) (*FileSystem, error) {
 		AGs:       []AG{*primaryAG},
 		cache:     cache,
 	}
+	for _, opt := range opts {
+		opt(&fileSystem)
+	}
+	if err := fileSystem.verifyAG(0, sectors); err != nil {
+		return nil, xerrors.Errorf("failed to verify primary allocation group: %w", err)
+	}
 
 	AGSize := int64(primaryAG.SuperBlock.Agblocks) * int64(primaryAG.SuperBlock.BlockSize)
 	for i := int64(1); i < int64(primaryAG.SuperBlock.Agcount); i++ {
@@ -73,10 +103,13 @@ func NewFS(r io.SectionReader, cache Cache[string, any]) (*FileSystem, error) {
 		if n != AGSize*i {
 			return nil, xerrors.Errorf(ErrSeekOffsetFormat, n, AGSize*i)
 		}
-		ag, err := ParseAG(&r)
+		ag, sectors, err := parseAG(&r)
 		if err != nil {
 			return nil, xerrors.Errorf("failed to parse allocation group %d: %w", i, err)
 		}
+		if err := fileSystem.verifyAG(uint64(i), sectors); err != nil {
+			return nil, xerrors.Errorf("failed to verify allocation group %d: %w", i, err)
+		}
 		fileSystem.AGs = append(fileSystem.AGs, *ag)
 	}
 	return &fileSystem, nil
@@ -89,43 +122,111 @@ func (xfs *FileSystem) Close() error {
 func (xfs *FileSystem) Stat(name string) (fs.FileInfo, error) {
 	const op = "stat"
 
-	f, err := xfs.Open(name)
+	inode, err := xfs.resolve(name, true)
 	if err != nil {
-		info, err := xfs.ReadDirInfo(name)
-		if err != nil {
-			return nil, xfs.wrapError(op, name, xerrors.Errorf("failed to read dir info: %w", err))
-		}
-		return info, nil
+		return nil, xfs.wrapError(op, name, xerrors.Errorf("failed to resolve path: %w", err))
 	}
-	return f.Stat()
+	return FileInfo{
+		name:  path.Base(name),
+		inode: inode,
+	}, nil
 }
 
-func (xfs *FileSystem) newFile(dirEntry dirEntry) (*File, error) {
-	var recs []BmbtRec
-	if dirEntry.inode.regularExtent != nil {
-		recs = dirEntry.inode.regularExtent.bmbtRecs
-	} else if dirEntry.inode.regularBtree != nil {
-		recs = dirEntry.inode.regularBtree.bmbtRecs
-	} else {
-		return nil, xerrors.Errorf("unsupported inode: %+v", dirEntry.inode)
+// Lstat returns a FileInfo describing the named file.
+// If the file is a symbolic link, the returned FileInfo describes the symbolic link.
+func (xfs *FileSystem) Lstat(name string) (fs.FileInfo, error) {
+	const op = "lstat"
+
+	inode, err := xfs.resolve(name, false)
+	if err != nil {
+		return nil, xfs.wrapError(op, name, xerrors.Errorf("failed to resolve path: %w", err))
 	}
+	return FileInfo{
+		name:  path.Base(name),
+		inode: inode,
+	}, nil
+}
 
-	dt := make(dataTable)
-	for _, rec := range recs {
-		p := rec.Unpack()
-		physicalBlockOffset := xfs.PrimaryAG.SuperBlock.BlockToPhysicalOffset(p.StartBlock)
-		for i := int64(0); i < int64(p.BlockCount); i++ {
-			dt[int64(p.StartOff)+i] = physicalBlockOffset + i
-		}
+// ReadLink returns the destination of the named symbolic link.
+func (xfs *FileSystem) ReadLink(name string) (string, error) {
+	const op = "readlink"
+
+	inode, err := xfs.resolve(name, false)
+	if err != nil {
+		return "", xfs.wrapError(op, name, xerrors.Errorf("failed to resolve path: %w", err))
+	}
+	if !inode.inodeCore.IsSymlink() {
+		return "", xfs.wrapError(op, name, fs.ErrInvalid)
+	}
+	target, err := inode.symlinkTarget()
+	if err != nil {
+		return "", xfs.wrapError(op, name, err)
+	}
+	return target, nil
+}
+
+// ResolvedPath is a path resolved inside the root of the filesystem.
+type ResolvedPath struct {
+	// Path is the canonical path, it has no symlinks, "." or ".." elements and is valid for Open.
+	Path string
+	// Ino is the inode number of the file Path refers to.
+	Ino uint64
+}
+
+// ResolveInRoot resolves name with the semantics of openat2(2) RESOLVE_IN_ROOT.
+// name may be absolute or contain "..", absolute symlink targets are resolved against
+// the root of the filesystem and ".." never climbs above it.
+// At most MaxSymlinkFollows symlinks are followed, then ErrTooManySymlinks is returned.
+func (xfs *FileSystem) ResolveInRoot(name string) (*ResolvedPath, error) {
+	const op = "resolve"
+
+	inode, p, err := xfs.walk(name, true)
+	if err != nil {
+		return nil, xfs.wrapError(op, name, err)
+	}
+	return &ResolvedPath{
+		Path: p,
+		Ino:  inode.inodeCore.Ino,
+	}, nil
+}
+
+// Realpath returns the canonical path of name, see ResolveInRoot.
+func (xfs *FileSystem) Realpath(name string) (string, error) {
+	resolved, err := xfs.ResolveInRoot(name)
+	if err != nil {
+		return "", err
+	}
+	return resolved.Path, nil
+}
+
+// OpenInRoot opens name resolved with ResolveInRoot.
+func (xfs *FileSystem) OpenInRoot(name string) (fs.File, error) {
+	const op = "open"
+
+	inode, p, err := xfs.walk(name, true)
+	if err != nil {
+		return nil, xfs.wrapError(op, name, err)
+	}
+	f, err := xfs.openInode(path.Base(p), inode)
+	if err != nil {
+		return nil, xfs.wrapError(op, name, err)
+	}
+	return f, nil
+}
+
+// newFile returns the File of a regular file. Devices, FIFOs and sockets have no data blocks,
+// they are opened as empty files.
+func (xfs *FileSystem) newFile(fileInfo FileInfo) (*File, error) {
+	inode := fileInfo.inode
+	if inode.inodeCore.IsRegular() && inode.regularExtent == nil && inode.regularBtree == nil {
+		return nil, xerrors.Errorf("unsupported inode %d of format %d", inode.inodeCore.Ino, inode.inodeCore.Format)
 	}
 
 	return &File{
-		fs:           xfs,
-		FileInfo:     dirEntry.FileInfo,
-		buffer:       bytes.NewBuffer(nil),
-		blockSize:    int64(xfs.PrimaryAG.SuperBlock.BlockSize),
-		currentBlock: -1,
-		table:        dt,
+		fs:        xfs,
+		FileInfo:  fileInfo,
+		blockSize: int64(xfs.PrimaryAG.SuperBlock.BlockSize),
+		bmap:      xfs.newBlockMap(fileInfo.inode),
 	}, nil
 }
 
@@ -174,16 +275,41 @@ func (xfs *FileSystem) getRootInode() (*Inode, error) {
 	return inode, nil
 }
 
-// TODO: support ReadFile Interface
 func (xfs *FileSystem) ReadFile(name string) ([]byte, error) {
-	panic("implement me")
-	return []byte{}, nil
+	const op = "read"
+
+	f, err := xfs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	file, ok := f.(*File)
+	if !ok {
+		return nil, xfs.wrapError(op, name, ErrIsDir)
+	}
+	buf := make([]byte, file.Size())
+	if _, err := io.ReadFull(file, buf); err != nil {
+		return nil, xfs.wrapError(op, name, xerrors.Errorf("failed to read file: %w", err))
+	}
+	return buf, nil
+}
+
+// baseFS hides Glob and Sub of FileSystem, so that fs.Glob and fs.Sub
+// fall back on ReadDir and friends instead of calling back into FileSystem.
+type baseFS interface {
+	fs.ReadDirFS
+	fs.ReadFileFS
+	fs.StatFS
+	fs.ReadLinkFS
 }
 
-// TODO: support GlobFS Interface
 func (xfs *FileSystem) Glob(pattern string) ([]string, error) {
-	panic("implement me")
-	return []string{}, nil
+	return fs.Glob(struct{ baseFS }{xfs}, pattern)
+}
+
+func (xfs *FileSystem) Sub(dir string) (fs.FS, error) {
+	return fs.Sub(struct{ baseFS }{xfs}, dir)
 }
 
 func (xfs *FileSystem) wrapError(op, path string, err error) error {
@@ -201,29 +327,33 @@ func (xfs *FileSystem) Open(name string) (fs.File, error) {
 		return nil, xfs.wrapError(op, name, fs.ErrInvalid)
 	}
 
-	dirName, fileName := filepath.Split(name)
-	dirEntries, err := xfs.ReadDir(dirName)
+	inode, err := xfs.resolve(name, true)
 	if err != nil {
-		return nil, xfs.wrapError(op, name, xerrors.Errorf("railed to read directory: %w", err))
+		return nil, xfs.wrapError(op, name, xerrors.Errorf("failed to resolve path: %w", err))
 	}
+	f, err := xfs.openInode(path.Base(name), inode)
+	if err != nil {
+		return nil, xfs.wrapError(op, name, err)
+	}
+	return f, nil
+}
 
-	for _, entry := range dirEntries {
-		if !entry.IsDir() && entry.Name() == fileName {
-			if dir, ok := entry.(dirEntry); ok {
-				if dir.Type().Perm()&0xA000 != 0 {
-					return nil, ErrOpenSymlink
-				}
-
-				f, err := xfs.newFile(dir)
-				if err != nil {
-					return nil, xerrors.Errorf("failed to new file: %w", err)
-				}
+func (xfs *FileSystem) openInode(name string, inode *Inode) (fs.File, error) {
+	if inode.inodeCore.IsDir() {
+		return xfs.newDir(FileInfo{
+			name:  name,
+			inode: inode,
+		}), nil
+	}
 
-				return f, nil
-			}
-		}
+	f, err := xfs.newFile(FileInfo{
+		name:  name,
+		inode: inode,
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to new file: %w", err)
 	}
-	return nil, fs.ErrNotExist
+	return f, nil
 }
 
 func (xfs *FileSystem) seekInode(n uint64) (int64, error) {
@@ -253,7 +383,7 @@ func (xfs *FileSystem) seekBlock(n int64) (int64, error) {
 func (xfs *FileSystem) readBlock(count uint32) ([]byte, error) {
 	buf := make([]byte, 0, xfs.PrimaryAG.SuperBlock.BlockSize*count)
 	for i := uint32(0); i < count; i++ {
-		b, err := utils.ReadBlock(xfs.r)
+		b, err := utils.ReadBlockSize(xfs.r, int(xfs.PrimaryAG.SuperBlock.BlockSize))
 		if err != nil {
 			return nil, err
 		}
@@ -263,95 +393,152 @@ func (xfs *FileSystem) readBlock(count uint32) ([]byte, error) {
 }
 
 func (xfs *FileSystem) readDirEntry(name string) ([]fs.DirEntry, error) {
-	inode, err := xfs.getRootInode()
+	inode, err := xfs.resolve(name, true)
 	if err != nil {
-		return nil, xerrors.Errorf("failed to get root inode: %w", err)
+		return nil, xerrors.Errorf("failed to resolve path: %w", err)
+	}
+	if !inode.inodeCore.IsDir() {
+		return nil, xerrors.Errorf("%s is file, directory: %w", name, fs.ErrNotExist)
 	}
 
-	fileInfos, err := xfs.listFileInfo(inode.inodeCore.Ino)
+	dirEntries, err := xfs.listDirEntries(inode)
 	if err != nil {
-		return nil, xerrors.Errorf("failed to list root inode directory entries: %w", err)
+		return nil, err
 	}
+	sort.Slice(dirEntries, func(i, j int) bool { return dirEntries[i].Name() < dirEntries[j].Name() })
+	return dirEntries, nil
+}
 
-	currentInode := inode
-	dirs := strings.Split(strings.Trim(filepath.Clean(name), string(filepath.Separator)), string(filepath.Separator))
-	for i, dir := range dirs {
-		found := false
-		for _, fileInfo := range fileInfos {
-			if fileInfo.Name() == dir {
-				if !fileInfo.IsDir() {
-					return nil, xerrors.Errorf("%s is file, directory: %w", fileInfo.Name(), fs.ErrNotExist)
-				}
-				found = true
-				currentInode = fileInfo.inode
-				break
-			}
-		}
-		// when dir string is empty ("", "."), that is root directory
-		if !found && (dir != "" && dir != ".") {
-			return nil, fs.ErrNotExist
-		}
+func (xfs *FileSystem) listDirEntries(inode *Inode) ([]fs.DirEntry, error) {
+	entries, err := xfs.listEntries(inode.inodeCore.Ino)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to list directory entries inode: %d: %w", inode.inodeCore.Ino, err)
+	}
 
-		fileInfos, err = xfs.listFileInfo(currentInode.inodeCore.Ino)
-		if err != nil {
-			return nil, xerrors.Errorf("failed to list directory entries inode: %d: %w", currentInode.inodeCore.Ino, err)
+	var dirEntries []fs.DirEntry
+	for _, entry := range entries {
+		// Skip current directory and parent directory
+		// infinit loop in walkDir
+		if entry.Name() == "." || entry.Name() == ".." {
+			continue
 		}
 
-		// list last directory
-		if i == len(dirs)-1 {
-			var dirEntries []fs.DirEntry
-			for _, fileInfo := range fileInfos {
-				// Skip current directory and parent directory
-				// infinit loop in walkDir
-				if fileInfo.Name() == "." || fileInfo.Name() == ".." {
-					continue
-				}
-
-				dirEntries = append(dirEntries, dirEntry{fileInfo})
-			}
-			return dirEntries, nil
-		}
+		dirEntries = append(dirEntries, xfs.newDirEntry(entry))
 	}
-	return nil, fs.ErrNotExist
+	return dirEntries, nil
 }
 
-func (xfs *FileSystem) listFileInfo(ino uint64) ([]FileInfo, error) {
-	entries, err := xfs.listEntries(ino)
+// resolve walks name from the root directory and returns the inode it refers to.
+// Symbolic links in intermediate components are always followed, the last component
+// is followed only when followLast is true.
+func (xfs *FileSystem) resolve(name string, followLast bool) (*Inode, error) {
+	inode, _, err := xfs.walk(name, followLast)
 	if err != nil {
-		return nil, xerrors.Errorf("failed to list entries: %w", err)
+		return nil, err
 	}
+	return inode, nil
+}
 
-	var fileInfos []FileInfo
-	for _, entry := range entries {
+// walk resolves name like openat2(2) with RESOLVE_IN_ROOT, and returns the inode
+// and the canonical path of it. Absolute symlink targets and ".." are resolved
+// against the root of the filesystem, so the walk never escapes from the root.
+func (xfs *FileSystem) walk(name string, followLast bool) (*Inode, string, error) {
+	root, err := xfs.getRootInode()
+	if err != nil {
+		return nil, "", xerrors.Errorf("failed to get root inode: %w", err)
+	}
+
+	// stack holds the inodes from the root directory to the current directory,
+	// and names holds the path components of stack[1:]
+	stack := []*Inode{root}
+	var names []string
+	rest := strings.Split(name, "/")
+	links := 0
+	for len(rest) > 0 {
+		elem := rest[0]
+		rest = rest[1:]
+
+		current := stack[len(stack)-1]
+		if elem == "" || elem == "." {
+			continue
+		}
+		if !current.inodeCore.IsDir() {
+			return nil, "", xerrors.Errorf("%s is file, directory: %w", path.Join(names...), fs.ErrNotExist)
+		}
+		if elem == ".." {
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+				names = names[:len(names)-1]
+			}
+			continue
+		}
 
-		inode, err := xfs.ParseInode(entry.InodeNumber())
+		ino, err := xfs.lookup(current, elem)
 		if err != nil {
-			return nil, xerrors.Errorf("failed to parse inode %d: %w", entry.InodeNumber(), err)
+			return nil, "", xerrors.Errorf("failed to lookup %s: %w", elem, err)
+		}
+		inode, err := xfs.ParseInode(ino)
+		if err != nil {
+			return nil, "", xerrors.Errorf("failed to parse inode %d: %w", ino, err)
+		}
+
+		if inode.inodeCore.IsSymlink() && (followLast || len(rest) > 0) {
+			links++
+			if links > MaxSymlinkFollows {
+				return nil, "", ErrTooManySymlinks
+			}
+			target, err := inode.symlinkTarget()
+			if err != nil {
+				return nil, "", xerrors.Errorf("failed to read symlink %s: %w", elem, err)
+			}
+			if strings.HasPrefix(target, "/") {
+				stack = stack[:1]
+				names = names[:0]
+			}
+			rest = append(strings.Split(target, "/"), rest...)
+			continue
 		}
-		// TODO: mode use inode.InodeCore.Mode
-		fileInfos = append(fileInfos,
-			FileInfo{
-				name:  entry.Name(),
-				inode: inode,
-			},
-		)
+		stack = append(stack, inode)
+		names = append(names, elem)
+	}
+	inode := stack[len(stack)-1]
+	if strings.HasSuffix(name, "/") && !inode.inodeCore.IsDir() {
+		return nil, "", xerrors.Errorf("%s is file, directory: %w", name, fs.ErrNotExist)
+	}
+	if len(names) == 0 {
+		return inode, ".", nil
 	}
-	return fileInfos, nil
+	return inode, path.Join(names...), nil
 }
 
-func (xfs *FileSystem) parseTree(bmbtRecs []BmbtRec) ([]Entry, error) {
+// parseTree reads the entries of all directory data blocks.
+// A directory block is BlockSize << Dirblklog bytes, it may span several extents.
+func (xfs *FileSystem) parseTree(bmap *blockMap) ([]Entry, error) {
+	sb := xfs.PrimaryAG.SuperBlock
+	dirBlocks := uint64(sb.DirBlockSize() / sb.BlockSize)
+	leafBlock := uint64(XFS_DIR2_LEAF_OFFSET / int64(sb.BlockSize))
+
 	var entries []Entry
-	for _, b := range bmbtRecs {
-		p := b.Unpack()
-		blockEntries, err := xfs.parseDir2Block(p)
+	var block uint64
+	for {
+		next, ok, err := bmap.nextMappedBlock(block)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to lookup directory block %d: %w", block, err)
+		}
+		block = next
+		// leaf and free blocks follow the data blocks
+		if !ok || block >= leafBlock {
+			return entries, nil
+		}
+		blockEntries, err := xfs.readDir2DataBlock(bmap, block)
 		if err != nil {
-			return nil, xerrors.Errorf("failed to parse dir2 block: %w", err)
+			return nil, xerrors.Errorf("failed to parse dir2 block %d: %w", block, err)
 		}
 		for _, entry := range blockEntries {
 			entries = append(entries, entry)
 		}
+		block += dirBlocks
 	}
-	return entries, nil
 }
 
 func (xfs *FileSystem) listEntries(ino uint64) ([]Entry, error) {
@@ -369,23 +556,11 @@ func (xfs *FileSystem) listEntries(ino uint64) ([]Entry, error) {
 		for _, entry := range inode.directoryLocal.entries {
 			entries = append(entries, entry)
 		}
-	} else if inode.directoryExtents != nil {
-		if len(inode.directoryExtents.bmbtRecs) == 0 {
-			return nil, xerrors.New("directory extents tree bmbtRecs is empty error")
-		}
-		entries, err = xfs.parseTree(inode.directoryExtents.bmbtRecs)
+	} else if inode.directoryExtents != nil || inode.directoryBtree != nil {
+		entries, err = xfs.parseTree(xfs.newBlockMap(inode))
 		if err != nil {
 			return nil, xerrors.Errorf("failed to parse extents tree: %w", err)
 		}
-	} else if inode.directoryBtree != nil {
-		if len(inode.directoryBtree.bmbtRecs) == 0 {
-			return nil, xerrors.New("directory extents btree bmbtRecs is empty error")
-		}
-		entries, err = xfs.parseTree(inode.directoryBtree.bmbtRecs)
-		if err != nil {
-			return nil, xerrors.Errorf("failed to parse btree: %w", err)
-		}
-
 	} else {
 		return nil, xerrors.New("not found entries")
 	}
@@ -404,7 +579,7 @@ func (i FileInfo) IsDir() bool {
 }
 
 func (i FileInfo) ModTime() time.Time {
-	return time.Unix(int64(i.inode.inodeCore.Mtime), 0)
+	return i.inode.inodeCore.ModifyTime()
 }
 
 func (i FileInfo) Size() int64 {
@@ -415,8 +590,51 @@ func (i FileInfo) Name() string {
 	return i.name
 }
 
+// Stat is the inode information returned by FileInfo.Sys.
+type Stat struct {
+	Ino    uint64
+	Mode   uint16
+	UID    uint32
+	GID    uint32
+	Nlink  uint32
+	Size   int64
+	Blocks uint64 // allocated filesystem blocks, including the attribute fork.
+	Gen    uint32
+	ProjID uint32
+
+	// Major and Minor are set for character and block devices only.
+	Major uint32
+	Minor uint32
+
+	Atime  time.Time
+	Mtime  time.Time
+	Ctime  time.Time
+	Crtime time.Time // zero for v1/v2 inodes
+}
+
+// Sys returns *Stat.
 func (i FileInfo) Sys() interface{} {
-	return nil
+	ic := i.inode.inodeCore
+	stat := &Stat{
+		Ino:    ic.Ino,
+		Mode:   ic.Mode,
+		UID:    ic.UID,
+		GID:    ic.GID,
+		Nlink:  ic.LinkCount(),
+		Size:   int64(ic.Size),
+		Blocks: ic.Nblocks,
+		Gen:    ic.Gen,
+		ProjID: ic.ProjectID(),
+		Atime:  ic.AccessTime(),
+		Mtime:  ic.ModifyTime(),
+		Ctime:  ic.ChangeTime(),
+		Crtime: ic.CreateTime(),
+	}
+	if i.inode.device != nil {
+		stat.Major = i.inode.device.Major()
+		stat.Minor = i.inode.device.Minor()
+	}
+	return stat
 }
 
 func (i FileInfo) Mode() fs.FileMode {
@@ -429,10 +647,10 @@ func (i FileInfo) Mode() fs.FileMode {
 		translatedMode |= fs.ModeSticky
 	}
 	if m&0o2000 != 0 {
-		translatedMode |= fs.ModeSetuid
+		translatedMode |= fs.ModeSetgid
 	}
 	if m&0o4000 != 0 {
-		translatedMode |= fs.ModeSetgid
+		translatedMode |= fs.ModeSetuid
 	}
 
 	// bits 13-16 are file type bits, defined in stat.h
@@ -448,7 +666,7 @@ func (i FileInfo) Mode() fs.FileMode {
 	case 0x4000:
 		translatedMode |= fs.ModeDir
 	case 0x2000:
-		translatedMode |= fs.ModeCharDevice
+		translatedMode |= fs.ModeDevice | fs.ModeCharDevice
 	case 0x1000:
 		translatedMode |= fs.ModeNamedPipe
 	default:
@@ -458,76 +676,247 @@ func (i FileInfo) Mode() fs.FileMode {
 	return translatedMode
 }
 
-// dirEntry is implemented io/fs DirEntry interface
+// dirEntry is implemented io/fs DirEntry interface.
+// The inode is parsed lazily, Type answers from the file type in the directory entry.
 type dirEntry struct {
-	FileInfo
+	fs       *FileSystem
+	name     string
+	ino      uint64
+	fileType uint8
+}
+
+func (xfs *FileSystem) newDirEntry(entry Entry) dirEntry {
+	return dirEntry{
+		fs:       xfs,
+		name:     entry.Name(),
+		ino:      entry.InodeNumber(),
+		fileType: entry.FileType(),
+	}
+}
+
+func (d dirEntry) Name() string {
+	return d.name
+}
+
+func (d dirEntry) IsDir() bool {
+	return d.Type().IsDir()
 }
 
 func (d dirEntry) Type() fs.FileMode {
-	return d.FileInfo.Mode().Type()
+	if mode, ok := fileTypeToMode(d.fileType); ok {
+		return mode
+	}
+
+	// the directory doesn't have file type, e.g. created without ftype feature.
+	info, err := d.Info()
+	if err != nil {
+		return fs.ModeIrregular
+	}
+	return info.Mode().Type()
+}
+
+func (d dirEntry) Info() (fs.FileInfo, error) {
+	inode, err := d.fs.ParseInode(d.ino)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse inode %d: %w", d.ino, err)
+	}
+	return FileInfo{
+		name:  d.name,
+		inode: inode,
+	}, nil
 }
 
-func (d dirEntry) Info() (fs.FileInfo, error) { return d.FileInfo, nil }
+// https://github.com/torvalds/linux/blob/5bfc75d92efd494db37f5c4c173d3639d4772966/fs/xfs/libxfs/xfs_da_format.h
+func fileTypeToMode(fileType uint8) (fs.FileMode, bool) {
+	switch fileType {
+	case XFS_DIR3_FT_REG_FILE:
+		return 0, true
+	case XFS_DIR3_FT_DIR:
+		return fs.ModeDir, true
+	case XFS_DIR3_FT_CHRDEV:
+		return fs.ModeDevice | fs.ModeCharDevice, true
+	case XFS_DIR3_FT_BLKDEV:
+		return fs.ModeDevice, true
+	case XFS_DIR3_FT_FIFO:
+		return fs.ModeNamedPipe, true
+	case XFS_DIR3_FT_SOCK:
+		return fs.ModeSocket, true
+	case XFS_DIR3_FT_SYMLINK:
+		return fs.ModeSymlink, true
+	default:
+		return 0, false
+	}
+}
 
 // File is implemented io/fs File interface
 type File struct {
 	fs *FileSystem
 	FileInfo
 
-	buffer *bytes.Buffer
+	// offset is the position of the next Read
+	offset int64
 
-	blockSize    int64
-	currentBlock int64
-	table        dataTable
+	blockSize int64
+	// blocks not mapped by bmap are holes.
+	bmap *blockMap
 }
 
-// map[offset]
-type dataTable map[int64]int64
-
 func (f *File) Stat() (fs.FileInfo, error) {
 	return &f.FileInfo, nil
 }
 
 func (f *File) Read(buf []byte) (int, error) {
-	if f.buffer == nil {
-		return 0, io.EOF
-	}
-	if f.buffer.Len() == 0 {
-		f.currentBlock++
-		if f.currentBlock*f.blockSize >= f.Size() {
-			f.buffer = nil
-			return 0, io.EOF
-		}
-	} else {
-		return f.buffer.Read(buf)
+	n, err := f.ReadAt(buf, f.offset)
+	f.offset += int64(n)
+	if n > 0 && err == io.EOF {
+		return n, nil
 	}
+	return n, err
+}
 
-	offset, ok := f.table[f.currentBlock]
-	if !ok {
-		if f.Size()-f.blockSize*f.currentBlock < f.blockSize {
-			f.buffer.Write(make([]byte, f.Size()-f.blockSize*f.currentBlock))
-		}
-		f.buffer.Write(make([]byte, f.blockSize))
-	} else {
-		_, err := f.fs.seekBlock(offset)
+// ReadAt implements io.ReaderAt. Holes and unwritten extents are read as zeros.
+// Each extent is read at once, it is contiguous on the disk.
+func (f *File) ReadAt(buf []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &fs.PathError{Op: "readat", Path: f.Name(), Err: fs.ErrInvalid}
+	}
+
+	var n int
+	for n < len(buf) && off < f.Size() {
+		length := min(int64(len(buf)-n), f.Size()-off)
+		block := uint64(off / f.blockSize)
+
+		// the first extent which ends after the block
+		extent, ok, err := f.bmap.lookup(block)
 		if err != nil {
-			return 0, xerrors.Errorf("failed to seek block: %w", err)
+			return n, xerrors.Errorf("failed to lookup extent of block %d: %w", block, err)
 		}
-		b, err := f.fs.readBlock(1)
-		if err != nil {
-			return 0, xerrors.Errorf("failed to read block: %w", err)
+		if !ok || extent.StartOff > block {
+			// hole, up to the next extent
+			if ok {
+				length = min(length, int64(extent.StartOff)*f.blockSize-off)
+			}
+			clear(buf[n : n+int(length)])
+		} else {
+			length = min(length, int64(extent.StartOff+extent.BlockCount)*f.blockSize-off)
+			dst := buf[n : n+int(length)]
+			if extent.Unwritten() {
+				clear(dst)
+			} else {
+				physicalBlock := f.fs.PrimaryAG.SuperBlock.BlockToPhysicalOffset(extent.StartBlock + block - extent.StartOff)
+				// read from the underlying SectionReader directly, ReadAt must not share the seek offset.
+				if _, err := f.fs.r.ReadAt(dst, physicalBlock*f.blockSize+off%f.blockSize); err != nil {
+					return n, xerrors.Errorf("failed to read block %d: %w", physicalBlock, err)
+				}
+			}
 		}
+		n += int(length)
+		off += length
+	}
+	if n < len(buf) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Seek implements io.Seeker, it sets the offset for the next Read.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.Size()
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.Name(), Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.Name(), Err: fs.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Extent is a mapping of file bytes to the disk, like FIEMAP.
+type Extent struct {
+	Logical   int64  // offset in the file, in bytes
+	Physical  int64  // offset in the device, in bytes
+	AG        uint64 // allocation group number which has the extent
+	Length    int64  // in bytes
+	Unwritten bool   // preallocated and read as zeros
+}
+
+// Extents returns the extents of the file sorted by the logical offset.
+// Holes are not included, and extents may exceed the file size by preallocation.
+func (f *File) Extents() ([]Extent, error) {
+	irecs, err := f.bmap.all()
+	if err != nil {
+		return nil, &fs.PathError{Op: "extents", Path: f.Name(), Err: err}
+	}
+
+	sb := f.fs.PrimaryAG.SuperBlock
+	extents := make([]Extent, 0, len(irecs))
+	for _, extent := range irecs {
+		extents = append(extents, Extent{
+			Logical:   int64(extent.StartOff) * f.blockSize,
+			Physical:  sb.BlockToPhysicalOffset(extent.StartBlock) * f.blockSize,
+			AG:        sb.BlockToAgNumber(extent.StartBlock),
+			Length:    int64(extent.BlockCount) * f.blockSize,
+			Unwritten: extent.Unwritten(),
+		})
+	}
+	return extents, nil
+}
 
-		if f.Size()-f.blockSize*f.currentBlock < f.blockSize {
-			b = b[:f.Size()-f.blockSize*f.currentBlock]
+// SeekData moves to the first data at or after offset like lseek(2) with SEEK_DATA, and returns the new offset.
+// Unwritten extents are treated as holes. It returns ErrNoData if there is no data after offset.
+func (f *File) SeekData(offset int64) (int64, error) {
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.Name(), Err: fs.ErrInvalid}
+	}
+	for offset < f.Size() {
+		extent, ok, err := f.bmap.lookup(uint64(offset / f.blockSize))
+		if err != nil {
+			return 0, &fs.PathError{Op: "seek", Path: f.Name(), Err: err}
+		}
+		if !ok {
+			break
 		}
-		n, err := f.buffer.Write(b)
-		if n != len(b) {
-			return 0, xerrors.Errorf("write buffer error: actual(%d), expected(%d)", n, len(b))
+		if !extent.Unwritten() {
+			offset = max(offset, int64(extent.StartOff)*f.blockSize)
+			if offset >= f.Size() {
+				break
+			}
+			f.offset = offset
+			return offset, nil
 		}
+		offset = int64(extent.StartOff+extent.BlockCount) * f.blockSize
 	}
+	return 0, &fs.PathError{Op: "seek", Path: f.Name(), Err: ErrNoData}
+}
 
-	return f.buffer.Read(buf)
+// SeekHole moves to the first hole at or after offset like lseek(2) with SEEK_HOLE, and returns the new offset.
+// The end of the file is a hole. It returns ErrNoData if offset is not less than the file size.
+func (f *File) SeekHole(offset int64) (int64, error) {
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.Name(), Err: fs.ErrInvalid}
+	}
+	if offset >= f.Size() {
+		return 0, &fs.PathError{Op: "seek", Path: f.Name(), Err: ErrNoData}
+	}
+	for offset < f.Size() {
+		extent, ok, err := f.bmap.lookup(uint64(offset / f.blockSize))
+		if err != nil {
+			return 0, &fs.PathError{Op: "seek", Path: f.Name(), Err: err}
+		}
+		if !ok || extent.Unwritten() || int64(extent.StartOff)*f.blockSize > offset {
+			break
+		}
+		// extents may be adjacent, continue to the end of the next one
+		offset = int64(extent.StartOff+extent.BlockCount) * f.blockSize
+	}
+	f.offset = min(offset, f.Size())
+	return f.offset, nil
 }
 
 func (f *File) Close() error {
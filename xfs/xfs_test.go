@@ -8,6 +8,8 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"testing/fstest"
+	"testing/iotest"
 
 	"github.com/masahiro331/go-xfs-filesystem/xfs"
 	"golang.org/x/xerrors"
@@ -92,6 +94,23 @@ func TestFileSystemCheckFileExtents(t *testing.T) {
 			if stat.Mode() != tt.mode {
 				t.Errorf("expected %s, actual %s", tt.mode, stat.Mode())
 			}
+
+			// the files are fully written, the first hole is the end of the file
+			file := testFile.(*xfs.File)
+			extents, err := file.Extents()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(extents) == 0 {
+				t.Errorf("expected extents, actual none")
+			}
+			hole, err := file.SeekHole(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hole != int64(tt.expectedSize) {
+				t.Errorf("expected hole at %d, actual %d", tt.expectedSize, hole)
+			}
 		})
 	}
 }
@@ -132,7 +151,7 @@ func TestFileSystemCheckWalkDir(t *testing.T) {
 	}
 
 	for _, tt := range testExecutableFileCases {
-		t.Run(fmt.Sprintf(tt.name), func(t *testing.T) {
+		t.Run(tt.name, func(t *testing.T) {
 			f, err := os.Open(tt.filesystem)
 			if err != nil {
 				t.Fatal(err)
@@ -291,3 +310,131 @@ func TestFileSystemCheckReadFile(t *testing.T) {
 		})
 	}
 }
+
+func TestFileSystemFileReadAtSeek(t *testing.T) {
+	f, err := os.Open("testdata/image.xfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileSystem, err := xfs.NewFS(*io.NewSectionReader(f, 0, info.Size()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := fileSystem.Open("etc/os-release")
+	if err != nil {
+		t.Fatalf("failed to open file: %v", err)
+	}
+	expectedBuf, err := os.ReadFile("testdata/os-release")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// iotest.TestReader checks ReadAt and Seek as well as Read
+	if err := iotest.TestReader(file, expectedBuf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileSystemFSTest(t *testing.T) {
+	f, err := os.Open("testdata/image.xfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileSystem, err := xfs.NewFS(*io.NewSectionReader(f, 0, info.Size()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = fstest.TestFS(fileSystem,
+		"etc/os-release",
+		"fmt_extents_file_1024",
+		"fmt_local_directory/short_form",
+		"fmt_leaf_directories/1",
+		"parent/child/child/child/child/executable",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileSystemOpenDir(t *testing.T) {
+	testDirectoryCases := []struct {
+		filesystem string
+		name       string
+		entriesLen int
+	}{
+		{
+			filesystem: "testdata/image.xfs",
+			name:       "fmt_extents_block_directories",
+			entriesLen: 8,
+		},
+		{
+			filesystem: "testdata/image.xfs",
+			name:       "fmt_leaf_directories",
+			entriesLen: 200,
+		},
+		{
+			filesystem: "testdata/image.xfs",
+			name:       "fmt_local_directory",
+			entriesLen: 1,
+		},
+		{
+			filesystem: "testdata/image.xfs",
+			name:       "fmt_node_directories",
+			entriesLen: 1024,
+		},
+	}
+
+	for _, tt := range testDirectoryCases {
+		t.Run(fmt.Sprintf("test %s paging", tt.name), func(t *testing.T) {
+			f, err := os.Open(tt.filesystem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			info, err := f.Stat()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fileSystem, err := xfs.NewFS(*io.NewSectionReader(f, 0, info.Size()), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// read 3 entries per page, and resume from the cookie with a new directory handle
+			names := map[string]struct{}{}
+			var cookie uint32
+			for {
+				dir, err := fileSystem.OpenDir(tt.name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				dir.Seekdir(cookie)
+				dirEntries, err := dir.ReadDir(3)
+				for _, entry := range dirEntries {
+					names[entry.Name()] = struct{}{}
+				}
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				cookie = dir.Tell()
+			}
+			if len(names) != tt.entriesLen {
+				t.Errorf("expected %d, actual %d", tt.entriesLen, len(names))
+			}
+		})
+	}
+}